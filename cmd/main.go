@@ -1,13 +1,26 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"log"
 	"net/http"
+	"pdf-microservice/internal/generator"
 	"pdf-microservice/internal/handlers"
+	"pdf-microservice/internal/jobs"
+	"pdf-microservice/internal/logos"
 	"pdf-microservice/internal/options"
+	"pdf-microservice/internal/outbox"
+	"pdf-microservice/internal/pdf"
+	"pdf-microservice/internal/qrtoken"
+	"pdf-microservice/internal/save"
+	"pdf-microservice/internal/save/local"
+	"pdf-microservice/internal/save/memory"
+	"pdf-microservice/internal/save/retry"
 	"pdf-microservice/internal/save/s3-storage"
+	"pdf-microservice/internal/signing"
 	"time"
 )
 
@@ -20,11 +33,87 @@ func main() {
 		log.Fatalf("Error loading config: %v", err)
 	}
 
-	s3Client, err := s3_storage.NewS3Client(cfg)
+	storage, err := newStorage(cfg)
 	if err != nil {
-		log.Fatalf("Error creating S3 client: %v", err)
+		log.Fatalf("Error creating storage: %v", err)
 	}
 
+	var localCopy save.Storage
+	if cfg.Api.LocalSave && cfg.Storage.Backend != "local" {
+		localCopy, err = local.NewStorage(cfg.Api.DirName)
+		if err != nil {
+			log.Fatalf("Error creating local storage: %v", err)
+		}
+	}
+
+	var logoSource logos.Source
+	if cfg.Logos.Fetch {
+		logoSource = logos.NewHTTPSource(cfg.Logos.FetchTimeout, cfg.Logos.Hosts)
+	}
+	logoCache, err := logos.NewCache(logoSource, cfg.Logos.CacheDir, cfg.Logos.FallbackDir)
+	if err != nil {
+		log.Fatalf("Error creating logo cache: %v", err)
+	}
+
+	var tokens *qrtoken.Issuer
+	if cfg.Verify.Secret != "" {
+		tokens, err = qrtoken.NewIssuer(cfg.Verify.Secret, cfg.Verify.BaseURL)
+		if err != nil {
+			log.Fatalf("Error creating token issuer: %v", err)
+		}
+	}
+
+	renderers, err := pdf.LoadRegistry(cfg.Layouts, pdf.Options{
+		Logos: logoCache,
+		Protection: pdf.Protection{
+			Enabled:         cfg.Protection.Enabled,
+			OwnerPassword:   cfg.Protection.OwnerPassword,
+			AllowPrint:      cfg.Protection.AllowPrint,
+			BookingPassword: cfg.Protection.BookingPassword,
+		},
+		PDFA:   cfg.PDFA.Enabled,
+		Tokens: tokens,
+	})
+	if err != nil {
+		log.Fatalf("Error loading layouts: %v", err)
+	}
+
+	var signer *signing.Signer
+	if cfg.Signing.Enabled {
+		if cfg.Protection.Enabled {
+			log.Fatalf("Signing and default password protection cannot be enabled together: encrypted documents are not signed")
+		}
+		if cfg.Signing.Visible && cfg.PDFA.Enabled {
+			log.Fatalf("Visible signature and PDF/A cannot be enabled together: the signature font is not embedded")
+		}
+		signer, err = newSigner(cfg.Signing)
+		if err != nil {
+			log.Fatalf("Error loading signing certificate: %v", err)
+		}
+	}
+
+	var box *outbox.Outbox
+	if cfg.Outbox.Enabled {
+		box, err = outbox.NewOutbox(cfg.Outbox.Dir, storage)
+		if err != nil {
+			log.Fatalf("Error opening outbox: %v", err)
+		}
+		go box.Run(context.Background(), cfg.Outbox.Interval)
+	}
+
+	var urlExpiry time.Duration
+	if cfg.Storage.Backend == "s3" {
+		urlExpiry = cfg.S3.URLExpiry
+	}
+	if urlExpiry > 0 && tokens == nil {
+		log.Printf("Storage links expire after %s and [verify] secret is not set: documents are printed without a QR code", urlExpiry)
+	}
+
+	gen := generator.NewGenerator(renderers, storage, localCopy, signer, box, urlExpiry, tokens)
+
+	jobStore := jobs.NewStore(cfg.Jobs.TTL)
+	go jobStore.RunCleanup(context.Background(), cfg.Jobs.CleanupInterval)
+
 	r := chi.NewRouter()
 
 	r.Use(middleware.RequestID)
@@ -35,10 +124,58 @@ func main() {
 
 	r.Get("/ping", handlers.PingHandler)
 
-	r.Method(http.MethodPost, "/generate", handlers.GeneratePDFHandler(cfg, s3Client))
+	r.Method(http.MethodPost, "/generate", handlers.GeneratePDFHandler(gen))
+
+	r.Post("/jobs", handlers.CreateJobHandler(gen, jobStore, cfg.Jobs.Timeout))
+	r.Get("/jobs/{id}", handlers.GetJobHandler(jobStore))
+
+	r.Post("/signatures/verify", handlers.VerifySignatureHandler(signer))
+	r.Get("/verify/{token}", handlers.VerifyTokenHandler(tokens))
+
+	r.Get("/files/{id}/url", handlers.FileURLHandler(storage, tokens, urlExpiry))
+
+	r.Get("/admin/outbox", handlers.OutboxHandler(box))
 
 	log.Println("Server starting on port " + cfg.Api.Port)
 	if err := http.ListenAndServe(":"+cfg.Api.Port, r); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
+
+func newStorage(cfg *options.Config) (save.Storage, error) {
+	switch cfg.Storage.Backend {
+	case "s3":
+		s3Client, err := s3_storage.NewS3Client(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("error creating S3 client: %w", err)
+		}
+		s3Storage, err := s3_storage.NewStorage(cfg, s3Client)
+		if err != nil {
+			return nil, err
+		}
+		return retry.NewStorage(s3Storage, retry.Options{
+			Attempts:       cfg.Storage.RetryAttempts,
+			BaseDelay:      cfg.Storage.RetryBaseDelay,
+			MaxDelay:       cfg.Storage.RetryMaxDelay,
+			AttemptTimeout: cfg.Storage.AttemptTimeout,
+			Transient:      s3_storage.IsTransient,
+		}, retry.NewBreaker(cfg.Storage.BreakerFailures, cfg.Storage.BreakerCooldown)), nil
+	case "local":
+		return local.NewStorage(cfg.Api.DirName)
+	case "memory":
+		return memory.NewStorage(), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+}
+
+func newSigner(cfg options.Signing) (*signing.Signer, error) {
+	appearance := signing.Appearance{Visible: cfg.Visible}
+	if cfg.Visible {
+		if len(cfg.Rect) != 4 {
+			return nil, fmt.Errorf("signing.rect must have 4 values, got %d", len(cfg.Rect))
+		}
+		copy(appearance.Rect[:], cfg.Rect)
+	}
+	return signing.NewSigner(cfg.CertFile, cfg.KeyFile, appearance)
+}
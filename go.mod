@@ -3,11 +3,14 @@ module pdf-microservice
 go 1.23
 
 require (
+	github.com/boombuler/barcode v1.0.2
 	github.com/go-chi/chi/v5 v5.2.0
 	github.com/go-pdf/fpdf v0.9.0
 	github.com/minio/minio-go/v7 v7.0.84
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+	github.com/smallstep/pkcs7 v0.2.3
 	github.com/spf13/viper v1.19.0
+	golang.org/x/text v0.21.0
 )
 
 require (
@@ -37,7 +40,6 @@ require (
 	golang.org/x/exp v0.0.0-20230905200255-921286631fa9 // indirect
 	golang.org/x/net v0.33.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
-	golang.org/x/text v0.21.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,144 @@
+package airports
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // В alpine-образе нет системной базы часовых поясов
+)
+
+// earthRadiusMiles - средний радиус Земли в статутных милях
+const earthRadiusMiles = 3958.8
+
+//go:embed airports.csv
+var airportsCSV []byte
+
+type Airport struct {
+	Code     string
+	Location *time.Location
+	// Latitude и Longitude - координаты в градусах, Positioned=false, если в таблице их нет
+	Latitude   float64
+	Longitude  float64
+	Positioned bool
+}
+
+var airports = mustLoad()
+
+func mustLoad() map[string]Airport {
+	loaded, err := load()
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+func load() (map[string]Airport, error) {
+	records, err := csv.NewReader(bytes.NewReader(airportsCSV)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read airports table: %w", err)
+	}
+
+	loaded := make(map[string]Airport, len(records))
+	for _, record := range records[1:] {
+		location, err := time.LoadLocation(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("airport %s: %w", record[0], err)
+		}
+		airport := Airport{Code: record[0], Location: location}
+
+		if record[2] != "" || record[3] != "" {
+			airport.Latitude, err = strconv.ParseFloat(record[2], 64)
+			if err != nil {
+				return nil, fmt.Errorf("airport %s: invalid latitude: %w", record[0], err)
+			}
+			airport.Longitude, err = strconv.ParseFloat(record[3], 64)
+			if err != nil {
+				return nil, fmt.Errorf("airport %s: invalid longitude: %w", record[0], err)
+			}
+			airport.Positioned = true
+		}
+
+		loaded[record[0]] = airport
+	}
+
+	return loaded, nil
+}
+
+// Lookup ищет аэропорт по коду IATA
+func Lookup(code string) (Airport, bool) {
+	airport, ok := airports[strings.ToUpper(strings.TrimSpace(code))]
+	return airport, ok
+}
+
+// ParseLocalTime разбирает время сегмента. Время без смещения ("2006-01-02T15:04:05") считается местным
+// временем аэропорта, время со смещением (RFC3339) переводится в часовой пояс аэропорта.
+// known=false, если аэропорта нет в таблице - тогда время остаётся как есть, без часового пояса
+func ParseLocalTime(value, code string) (t time.Time, known bool, err error) {
+	airport, known := Lookup(code)
+
+	t, err = time.Parse(time.RFC3339, value)
+	if err == nil {
+		if known {
+			t = t.In(airport.Location)
+		}
+		return t, known, nil
+	}
+
+	location := time.UTC
+	if known {
+		location = airport.Location
+	}
+	t, err = time.ParseInLocation("2006-01-02T15:04:05", value, location)
+	return t, known, err
+}
+
+// UTCOffset форматирует смещение времени от UTC: "UTC+3", "UTC+5:30", "UTC-7", "UTC"
+func UTCOffset(t time.Time) string {
+	_, offset := t.Zone()
+	if offset == 0 {
+		return "UTC"
+	}
+
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	hours, minutes := offset/3600, offset%3600/60
+	if minutes == 0 {
+		return fmt.Sprintf("UTC%s%d", sign, hours)
+	}
+	return fmt.Sprintf("UTC%s%d:%02d", sign, hours, minutes)
+}
+
+// DayShift возвращает, на сколько календарных дней дата прилёта (по местному времени прилёта)
+// отличается от даты вылета (по местному времени вылета)
+func DayShift(departure, arrival time.Time) int {
+	dy, dm, dd := departure.Date()
+	ay, am, ad := arrival.Date()
+	from := time.Date(dy, dm, dd, 0, 0, 0, 0, time.UTC)
+	to := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// DistanceMiles возвращает расстояние по большому кругу между аэропортами в милях,
+// ok=false, если координат какого-то из аэропортов нет в таблице
+func DistanceMiles(from, to string) (miles int, ok bool) {
+	a, okFrom := Lookup(from)
+	b, okTo := Lookup(to)
+	if !okFrom || !okTo || !a.Positioned || !b.Positioned {
+		return 0, false
+	}
+
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Pow(math.Sin(dLat/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin(dLon/2), 2)
+	return int(math.Round(2 * earthRadiusMiles * math.Asin(math.Sqrt(h)))), true
+}
@@ -0,0 +1,117 @@
+package bcbp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Leg - данные одного сегмента для посадочного талона в формате IATA BCBP (Resolution 792)
+type Leg struct {
+	FirstName    string
+	LastName     string
+	PNR          string
+	From         string
+	To           string
+	Carrier      string
+	FlightNumber string
+	Date         time.Time
+	Compartment  string
+	Seat         string
+}
+
+// Encode собирает обязательную часть BCBP формата M для одного сегмента (60 символов)
+func Encode(leg Leg) string {
+	var b strings.Builder
+
+	b.WriteString("M1")
+	b.WriteString(field(name(leg.LastName, leg.FirstName), 20))
+	b.WriteString("E")
+	b.WriteString(field(leg.PNR, 7))
+	b.WriteString(field(leg.From, 3))
+	b.WriteString(field(leg.To, 3))
+	b.WriteString(field(leg.Carrier, 3))
+	b.WriteString(flightNumber(leg.FlightNumber))
+	b.WriteString(julianDate(leg.Date))
+	b.WriteString(field(leg.Compartment, 1))
+	b.WriteString(seat(leg.Seat))
+	b.WriteString(field("", 5)) // Номер регистрации появляется только после check-in
+	b.WriteString("0")          // Статус пассажира: билет оформлен, регистрация не пройдена
+	b.WriteString("00")         // Размер условной части, условные поля не передаются
+
+	return b.String()
+}
+
+// MaxTicketID - наибольший номер бронирования, который помещается в 7 символов PNR в base36
+const MaxTicketID = 36*36*36*36*36*36*36 - 1
+
+// PNR приводит номер бронирования к 7 символам BCBP, длинные номера переводятся в base36.
+// Номера больше MaxTicketID отклоняет validation
+func PNR(ticketID int) string {
+	pnr := strconv.Itoa(ticketID)
+	if len(pnr) > 7 {
+		pnr = strings.ToUpper(strconv.FormatInt(int64(ticketID), 36))
+	}
+	return pnr
+}
+
+// Compartment переводит класс обслуживания из запроса в код салона
+func Compartment(flightClass string) string {
+	switch strings.ToLower(strings.ReplaceAll(flightClass, " ", "_")) {
+	case "first":
+		return "F"
+	case "business":
+		return "C"
+	case "premium_economy", "comfort":
+		return "W"
+	default:
+		return "Y"
+	}
+}
+
+func name(last, first string) string {
+	return ascii(last) + "/" + ascii(first)
+}
+
+// field выравнивает значение влево и дополняет пробелами до фиксированной длины
+func field(value string, size int) string {
+	value = strings.ToUpper(value)
+	if len(value) > size {
+		return value[:size]
+	}
+	return value + strings.Repeat(" ", size-len(value))
+}
+
+// flightNumber - 4 цифры с ведущими нулями и необязательный буквенный суффикс
+func flightNumber(number string) string {
+	digits := strings.TrimRightFunc(number, unicode.IsLetter)
+	suffix := number[len(digits):]
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 || n > 9999 {
+		n = 0
+	}
+	return fmt.Sprintf("%04d", n) + field(suffix, 1)
+}
+
+func julianDate(date time.Time) string {
+	if date.IsZero() {
+		return "   "
+	}
+	return fmt.Sprintf("%03d", date.YearDay())
+}
+
+// seat - 3 цифры ряда с ведущими нулями и буква места, например 012A
+func seat(value string) string {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return field("", 4)
+	}
+	row := strings.TrimRightFunc(value, unicode.IsLetter)
+	n, err := strconv.Atoi(row)
+	if err != nil {
+		return field(value, 4)
+	}
+	return fmt.Sprintf("%03d", n) + field(value[len(row):], 1)
+}
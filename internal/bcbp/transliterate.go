@@ -0,0 +1,37 @@
+package bcbp
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+// icao - транслитерация ICAO 9303 (часть 3) для букв, которые не сводятся к латинской букве без диакритики.
+// Остальные латинские буквы с диакритикой теряют её (É - E, Ş - S)
+var icao = map[rune]string{
+	'Ä': "AE", 'Å': "AA", 'Æ': "AE", 'Ö': "OE", 'Ø': "OE", 'Ü': "UE", 'ß': "SS", 'ẞ': "SS", 'Þ': "TH", 'Œ': "OE",
+	'Ĳ': "IJ", 'Ð': "D", 'Đ': "D", 'Ħ': "H", 'Ł': "L", 'Ŀ': "L", 'Ŧ': "T",
+
+	'А': "A", 'Б': "B", 'В': "V", 'Г': "G", 'Ґ': "G", 'Ѓ': "G", 'Д': "D", 'Ђ': "D", 'Е': "E", 'Ё': "E",
+	'Є': "IE", 'Ж': "ZH", 'З': "Z", 'Ѕ': "DZ", 'И': "I", 'І': "I", 'Ї': "I", 'Й': "I", 'Ј': "J", 'К': "K",
+	'Ќ': "K", 'Л': "L", 'Љ': "LJ", 'М': "M", 'Н': "N", 'Њ': "NJ", 'О': "O", 'П': "P", 'Р': "R", 'С': "S",
+	'Т': "T", 'Ћ': "C", 'У': "U", 'Ў': "U", 'Ф': "F", 'Х': "KH", 'Ц': "TS", 'Ч': "CH", 'Џ': "DZ", 'Ш': "SH",
+	'Щ': "SHCH", 'Ъ': "IE", 'Ы': "Y", 'Ь': "", 'Э': "E", 'Ю': "IU", 'Я': "IA",
+}
+
+// ascii транслитерирует имя по ICAO 9303 и оставляет только латинские буквы, пробелы и дефисы в верхнем регистре
+func ascii(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		r = unicode.ToUpper(r)
+		if latin, ok := icao[r]; ok {
+			b.WriteString(latin)
+			continue
+		}
+		// Первая руна разложения - буква без диакритических знаков
+		if base := []rune(norm.NFD.String(string(r)))[0]; (base >= 'A' && base <= 'Z') || base == ' ' || base == '-' {
+			b.WriteRune(base)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,318 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"pdf-microservice/internal/models"
+	"pdf-microservice/internal/outbox"
+	"pdf-microservice/internal/pdf"
+	"pdf-microservice/internal/qrtoken"
+	"pdf-microservice/internal/save"
+	"pdf-microservice/internal/signing"
+	"pdf-microservice/internal/validation"
+	"strings"
+	"sync"
+	"time"
+)
+
+const contentTypePDF = "application/pdf"
+
+// ProgressFunc вызывается при каждой смене статуса документа, result - копия текущего состояния.
+// Для общего документа бронирования passenger равен models.CombinedDocument
+type ProgressFunc func(booking, passenger int, result models.DocumentResult)
+
+type Generator struct {
+	renderers *pdf.Registry
+	storage   save.Storage
+	localCopy save.Storage
+	signer    *signing.Signer
+	outbox    *outbox.Outbox
+	// urlExpiry - срок ссылок хранилища, 0 - ссылки бессрочные
+	urlExpiry time.Duration
+	// tokens подписывает идентификаторы файлов для новых ссылок, nil - идентификаторы не выдаются
+	tokens *qrtoken.Issuer
+	sem    chan struct{}
+}
+
+// NewGenerator создаёт генератор, сохраняющий билеты в storage.
+// localCopy - необязательное дополнительное хранилище для локальных копий, может быть nil,
+// signer - подпись готовых документов, nil - документы не подписываются,
+// outbox - спул для документов, которые не удалось загрузить, nil - такие документы не сохраняются,
+// urlExpiry - срок ссылок storage, истекающие ссылки возвращаются в ответе, но не печатаются в QR-коде,
+// tokens - выпуск идентификаторов файлов для GET /files/{id}/url, nil - идентификаторы не выдаются
+func NewGenerator(renderers *pdf.Registry, storage save.Storage, localCopy save.Storage, signer *signing.Signer, outbox *outbox.Outbox, urlExpiry time.Duration, tokens *qrtoken.Issuer) *Generator {
+	return &Generator{
+		renderers: renderers,
+		storage:   storage,
+		localCopy: localCopy,
+		signer:    signer,
+		outbox:    outbox,
+		urlExpiry: urlExpiry,
+		tokens:    tokens,
+		sem:       make(chan struct{}, 10), // Ограничение на 10 горутин на весь сервис
+	}
+}
+
+// Generate рендерит, сохраняет и загружает билеты всех пассажиров всех бронирований.
+// Блокируется до завершения обработки, progress может быть nil
+func (g *Generator) Generate(ctx context.Context, requestData []models.RequestData, progress ProgressFunc) []models.BookingResult {
+
+	results := models.NewBookingResults(requestData)
+
+	var wg sync.WaitGroup
+
+	for i, booking := range requestData {
+		if booking.Individual() {
+			filenames := models.Filenames(booking)
+			for j, passenger := range booking.User.Passengers() {
+				wg.Add(1)
+				go func(i, j int, booking models.RequestData, passenger models.Passenger) {
+					defer wg.Done()
+					g.produce(ctx, passenger.FirstName+" "+passenger.LastName, &results[i].Passengers[j].DocumentResult, func(result models.DocumentResult) {
+						if progress != nil {
+							progress(i, j, result)
+						}
+					}, func() (*models.File, error) {
+						return g.render(ctx, booking, passenger, filenames[j], true)
+					})
+				}(i, j, booking, passenger)
+			}
+		}
+
+		if booking.HasCombined() {
+			wg.Add(1)
+			go func(i int, booking models.RequestData) {
+				defer wg.Done()
+				g.produce(ctx, fmt.Sprintf("booking %d", booking.Ticket.ID), results[i].Combined, func(result models.DocumentResult) {
+					if progress != nil {
+						progress(i, models.CombinedDocument, result)
+					}
+				}, func() (*models.File, error) {
+					return g.renderBooking(ctx, booking, true)
+				})
+			}(i, booking)
+		}
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// produce рендерит документ, сохраняет локальную копию и загружает в хранилище, отмечая стадии в result.
+// name - кому принадлежит документ, для логов
+func (g *Generator) produce(ctx context.Context, name string, result *models.DocumentResult, progress func(models.DocumentResult), render func() (*models.File, error)) {
+	g.sem <- struct{}{} // Семафор
+	defer func() { <-g.sem }()
+
+	report := func(status models.PassengerStatus) {
+		result.Status = status
+		progress(*result)
+	}
+	fail := func(code models.ErrorCode, err error) {
+		result.Error = &models.PassengerError{Code: code, Message: err.Error()}
+		report(models.StatusFailed)
+	}
+
+	report(models.StatusRendering)
+
+	file, err := render()
+	if err != nil {
+		log.Printf("Error generating PDF for %s: %v", name, err)
+		fail(models.ErrCodeRenderFailed, err)
+		return
+	}
+	result.Filename = file.Filename
+	// Идентификатор для новых ссылок отдаётся вместе со ссылкой, только когда файл сохранён
+	var fileID string
+	if g.tokens != nil {
+		fileID = g.tokens.FileHandle(file.Filename)
+	}
+
+	report(models.StatusUploading)
+
+	if g.localCopy != nil {
+		err = g.localCopy.Put(ctx, file.Filename, file.Bytes, contentTypePDF)
+		if err != nil {
+			log.Printf("Failed to save PDF locally for %s: %v", name, err)
+			fail(models.ErrCodeLocalSaveFailed, err)
+			return
+		}
+		result.LocalPath = file.Filename
+	}
+
+	err = g.storage.Put(ctx, file.Filename, file.Bytes, contentTypePDF)
+	if err != nil {
+		log.Printf("Failed to upload to storage for %s: %v", name, err)
+		if g.outbox == nil {
+			fail(models.ErrCodeUploadFailed, err)
+			return
+		}
+		// Документ выгрузится из спула, когда хранилище восстановится, ссылка на него уже известна
+		if spoolErr := g.outbox.Add(file.Filename, file.Bytes, contentTypePDF); spoolErr != nil {
+			log.Printf("Failed to spool PDF for %s: %v", name, spoolErr)
+			fail(models.ErrCodeUploadFailed, err)
+			return
+		}
+		result.URL, result.FileID = file.URL, fileID
+		report(models.StatusSpooled)
+		return
+	}
+	result.URL, result.FileID = file.URL, fileID
+	report(models.StatusDone)
+}
+
+// Render только рендерит билеты, ничего не сохраняя. Порядок файлов совпадает с порядком
+// бронирований и пассажиров в запросе, общий документ бронирования идёт после документов пассажиров.
+// При первой ошибке возвращается ошибка. Хранилище не используется, поэтому в QR-коде только ссылка на проверку
+// токена, а без токенов QR-кода нет
+func (g *Generator) Render(ctx context.Context, requestData []models.RequestData) ([]*models.File, error) {
+
+	// Сначала собираются все документы, чтобы files не рос, пока в него пишут рендеры
+	var renders []func() (*models.File, error)
+	for _, booking := range requestData {
+		if booking.Individual() {
+			filenames := models.Filenames(booking)
+			for j, passenger := range booking.User.Passengers() {
+				renders = append(renders, func() (*models.File, error) {
+					file, err := g.render(ctx, booking, passenger, filenames[j], false)
+					if err != nil {
+						return nil, fmt.Errorf("%s %s: %w", passenger.FirstName, passenger.LastName, err)
+					}
+					return file, nil
+				})
+			}
+		}
+		if booking.HasCombined() {
+			renders = append(renders, func() (*models.File, error) {
+				file, err := g.renderBooking(ctx, booking, false)
+				if err != nil {
+					return nil, fmt.Errorf("booking %d: %w", booking.Ticket.ID, err)
+				}
+				return file, nil
+			})
+		}
+	}
+
+	files := make([]*models.File, len(renders))
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for idx, render := range renders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.sem <- struct{}{} // Семафор
+			defer func() { <-g.sem }()
+
+			file, err := render()
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+			files[idx] = file
+		}()
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	return files, nil
+}
+
+// SupportsDocument сообщает, есть ли макет для типа документа
+func (g *Generator) SupportsDocument(documentType string) bool {
+	_, err := g.renderers.Renderer(documentType)
+	return err == nil
+}
+
+// Check проверяет бронирование на совместимость с настройками сервиса, которых не знает validation.
+// Поля ошибок - относительно бронирования, неподдерживаемый тип документа не проверяется
+func (g *Generator) Check(booking models.RequestData) []validation.FieldError {
+	renderer, err := g.renderers.Renderer(booking.Document())
+	if err != nil {
+		return nil
+	}
+
+	var errs []validation.FieldError
+	protected := renderer.Protected(booking)
+	if renderer.MissingPassword(booking) {
+		errs = append(errs, validation.FieldError{Field: "protection.password", Message: "is required for a password protected document"})
+	}
+	// Подпись поверх шифрования fpdf не поддерживается, а неподписанный документ при включённой подписи
+	// выглядел бы для клиента как подписанный
+	if protected && g.signer != nil {
+		errs = append(errs, validation.FieldError{Field: "protection", Message: "signed documents cannot be password protected"})
+	}
+	// Видимая подпись рисуется невстроенным шрифтом, что запрещено в PDF/A
+	if g.signer != nil && g.signer.Visible() && renderer.Archived(booking) {
+		errs = append(errs, validation.FieldError{Field: "pdfa", Message: "is not supported with a visible signature"})
+	}
+	return errs
+}
+
+func (g *Generator) render(ctx context.Context, booking models.RequestData, passenger models.Passenger, filename string, stored bool) (*models.File, error) {
+	name := strings.ToUpper(passenger.FirstName + "/" + passenger.LastName)
+	return g.renderFile(ctx, booking, filename, name, stored, func(renderer *pdf.Renderer, url string) ([]byte, error) {
+		return renderer.GeneratePDF(booking, passenger, url)
+	})
+}
+
+// renderBooking рендерит общий документ бронирования со всеми пассажирами
+func (g *Generator) renderBooking(ctx context.Context, booking models.RequestData, stored bool) (*models.File, error) {
+	return g.renderFile(ctx, booking, models.BookingFilename(booking), "", stored, func(renderer *pdf.Renderer, url string) ([]byte, error) {
+		return renderer.GenerateBookingPDF(booking, url)
+	})
+}
+
+// renderFile рендерит и подписывает документ, passenger - имя пассажира для подписи, пусто для общего документа.
+// stored - документ будет загружен в хранилище, иначе ссылки на него нет. В QR-код попадает только бессрочная ссылка
+func (g *Generator) renderFile(ctx context.Context, booking models.RequestData, filename, passenger string, stored bool, generate func(*pdf.Renderer, string) ([]byte, error)) (file *models.File, err error) {
+
+	// Паника в рендере не должна ронять весь сервис
+	defer func() {
+		if rec := recover(); rec != nil {
+			file, err = nil, fmt.Errorf("panic: %v", rec)
+		}
+	}()
+
+	renderer, err := g.renderers.Renderer(booking.Document())
+	if err != nil {
+		return nil, err
+	}
+
+	file = &models.File{Filename: filename}
+	if stored {
+		file.URL, err = g.storage.URL(ctx, file.Filename)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build file url: %w", err)
+		}
+	}
+
+	// Билет печатают и хранят дольше, чем живёт подписанная ссылка, поэтому в QR-код она не попадает
+	qrURL := file.URL
+	if g.urlExpiry > 0 {
+		qrURL = ""
+	}
+	file.Bytes, err = generate(renderer, qrURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if g.signer != nil {
+		// Защищённые паролем документы при включённой подписи отклоняются ещё в Check
+		file.Bytes, err = g.signer.Sign(file.Bytes, signing.Info{BookingID: booking.Ticket.ID, Passenger: passenger, Document: booking.Document()})
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign: %w", err)
+		}
+	}
+
+	return file, nil
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"path"
+	"pdf-microservice/internal/qrtoken"
+	"pdf-microservice/internal/save"
+	"time"
+)
+
+type fileURLResponse struct {
+	Filename  string     `json:"filename"`
+	URL       string     `json:"url"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// FileURLHandler выдаёт новую ссылку на уже загруженный документ, id - file_id из ответа генерации:
+// имя файла, подписанное issuer, чтобы чужие документы нельзя было найти перебором имён.
+// expiry - срок ссылок хранилища, 0 - ссылки бессрочные; issuer = nil - выдача ссылок не настроена, 404
+func FileURLHandler(storage save.Storage, issuer *qrtoken.Issuer, expiry time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if issuer == nil {
+			http.Error(w, "File links are not configured", http.StatusNotFound)
+			return
+		}
+
+		id, err := issuer.ParseFileHandle(chi.URLParam(r, "id"))
+		if errors.Is(err, qrtoken.ErrSignature) {
+			// Неверная подпись неотличима от отсутствующего файла
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if err != nil || id == "" || id != path.Base(id) || id == "." || id == ".." {
+			http.Error(w, "Invalid file id", http.StatusBadRequest)
+			return
+		}
+
+		exists, err := storage.Exists(r.Context(), id)
+		if err != nil {
+			log.Printf("Failed to check file %s: %v", id, err)
+			http.Error(w, "Failed to check file", http.StatusBadGateway)
+			return
+		}
+		if !exists {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+
+		issuedAt := time.Now()
+		url, err := storage.URL(r.Context(), id)
+		if err != nil {
+			log.Printf("Failed to build url for %s: %v", id, err)
+			http.Error(w, "Failed to build file url", http.StatusInternalServerError)
+			return
+		}
+
+		response := fileURLResponse{Filename: id, URL: url}
+		if expiry > 0 {
+			expiresAt := issuedAt.Add(expiry).UTC().Truncate(time.Second)
+			response.ExpiresAt = &expiresAt
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		// Ссылка подписана и ограничена по времени, кэшировать ответ нельзя
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+		if err = json.NewEncoder(w).Encode(response); err != nil {
+			log.Printf("Failed to encode JSON response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"pdf-microservice/internal/generator"
+	"pdf-microservice/internal/jobs"
+	"pdf-microservice/internal/models"
+	"time"
+)
+
+type createJobResponse struct {
+	JobID     string      `json:"job_id"`
+	Status    jobs.Status `json:"status"`
+	StatusURL string      `json:"status_url"`
+}
+
+// CreateJobHandler ставит генерацию в очередь и сразу возвращает идентификатор задачи.
+// timeout - сколько задаче отводится на генерацию и загрузку, 0 - без ограничения
+func CreateJobHandler(gen *generator.Generator, store *jobs.Store, timeout time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		requestData, ok := decodeRequest(w, r, gen)
+		if !ok {
+			return
+		}
+
+		job, err := store.Create(requestData)
+		if err != nil {
+			log.Printf("Failed to create job: %v", err)
+			http.Error(w, "Failed to create job", http.StatusInternalServerError)
+			return
+		}
+
+		// Задача живёт дольше запроса, поэтому контекст запроса не используется, у задачи свой срок
+		go func() {
+			ctx, cancel := context.Background(), context.CancelFunc(func() {})
+			if timeout > 0 {
+				ctx, cancel = context.WithTimeout(ctx, timeout)
+			}
+			defer cancel()
+
+			results := gen.Generate(ctx, requestData, func(booking, passenger int, result models.DocumentResult) {
+				store.UpdateDocument(job.ID, booking, passenger, result)
+			})
+			store.Complete(job.ID, results)
+			log.Printf("Job %s completed", job.ID)
+		}()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		w.WriteHeader(http.StatusAccepted)
+		if err = json.NewEncoder(w).Encode(createJobResponse{
+			JobID:     job.ID,
+			Status:    job.Status,
+			StatusURL: "/jobs/" + job.ID,
+		}); err != nil {
+			log.Printf("Failed to encode JSON response: %v", err)
+		}
+	}
+}
+
+func GetJobHandler(store *jobs.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		job, ok := store.Get(chi.URLParam(r, "id"))
+		if !ok {
+			http.Error(w, "Job not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err := json.NewEncoder(w).Encode(job); err != nil {
+			log.Printf("Failed to encode JSON response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"pdf-microservice/internal/outbox"
+)
+
+// OutboxHandler возвращает состояние спула незагруженных документов: глубину, объём и возраст самого
+// старого документа. box = nil - спул выключен, 404
+func OutboxHandler(box *outbox.Outbox) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if box == nil {
+			http.Error(w, "Outbox is not enabled", http.StatusNotFound)
+			return
+		}
+
+		stats, err := box.Stats()
+		if err != nil {
+			log.Printf("Failed to read outbox: %v", err)
+			http.Error(w, "Failed to read outbox", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		if err = json.NewEncoder(w).Encode(stats); err != nil {
+			log.Printf("Failed to encode JSON response: %v", err)
+		}
+	}
+}
@@ -3,87 +3,72 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
-	"github.com/minio/minio-go/v7"
 	"log"
 	"net/http"
+	"pdf-microservice/internal/generator"
 	"pdf-microservice/internal/models"
-	"pdf-microservice/internal/options"
-	"pdf-microservice/internal/pdf"
-	"pdf-microservice/internal/save/local"
-	"pdf-microservice/internal/save/s3-storage"
-	"sync"
 )
 
-func GeneratePDFHandler(cfg *options.Config, s3Client *minio.Client) http.HandlerFunc {
+func GeneratePDFHandler(gen *generator.Generator) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		var err error
-		var requestData []models.RequestData
-
-		if err = json.NewDecoder(r.Body).Decode(&requestData); err != nil {
-			http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		requestData, ok := decodeRequest(w, r, gen)
+		if !ok {
 			return
 		}
 
-		resultFiles := make(map[string]*models.File)
-		var mu sync.Mutex
-		response := make(map[string]string)
-
-		var wg sync.WaitGroup
-		sem := make(chan struct{}, 10) // Ограничение на 10 горутин
-
-		for _, adult := range requestData[0].User.Adults {
-			wg.Add(1)
-			go func(adult models.Adult) {
-				defer wg.Done()
-				sem <- struct{}{} // Семафор
-				defer func() { <-sem }()
-
-				file := models.NewFile(requestData[0].Ticket.ID, adult.FirstName, adult.LastName, cfg)
-				file.Bytes, err = pdf.GeneratePDF(requestData[0].Ticket, adult, file.S3URL)
-				if err != nil {
-					log.Printf("Error generating PDF for %s %s: %v", adult.FirstName, adult.LastName, err)
-					return
-				}
-
-				mu.Lock()
-				resultFiles[file.Filename] = file
-				mu.Unlock()
-
-				if cfg.Api.LocalSave {
-					err = local.SaveLocalPDF(cfg, file.Filename, file.Bytes)
-					if err != nil {
-						log.Printf("Failed to save PDF locally for %s %s: %v", adult.FirstName, adult.LastName, err)
-						return
-					}
-					pdfKey := fmt.Sprint(adult.FirstName + "-" + adult.LastName + "-local-pdf")
-					mu.Lock()
-					response[pdfKey] = file.Filename
-					mu.Unlock()
-				}
+		mode, err := outputMode(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-				err = s3_storage.UploadFile(cfg, s3Client, file.Filename, file.Bytes)
-				if err != nil {
-					log.Printf("Failed to upload to S3 for %s %s: %v", adult.FirstName, adult.LastName, err)
-					return
-				}
-				s3Key := fmt.Sprint(adult.FirstName + "-" + adult.LastName + "-s3-storage-url")
-				mu.Lock()
-				response[s3Key] = file.S3URL
-				mu.Unlock()
-			}(adult)
+		if mode != outputJSON {
+			streamPDFs(w, r, gen, requestData, mode)
+			return
 		}
 
-		wg.Wait()
+		response := models.NewGenerateResponse(gen.Generate(r.Context(), requestData, nil))
 
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(response.HTTPStatus())
 		if err = json.NewEncoder(w).Encode(response); err != nil {
 			log.Printf("Failed to encode JSON response: %v", err)
-			http.Error(w, "Failed to encode JSON response", http.StatusBadRequest)
 			return
 		}
 
-		log.Printf("Successfully generated and uploaded PDFs")
+		log.Printf("Generated PDFs for %d bookings: %d succeeded, %d failed", len(requestData), response.Succeeded, response.Failed)
+	}
+}
+
+// streamPDFs отдаёт билеты прямо в ответе, минуя локальное сохранение и S3
+func streamPDFs(w http.ResponseWriter, r *http.Request, gen *generator.Generator, requestData []models.RequestData, mode string) {
+
+	documents := 0
+	for _, booking := range requestData {
+		documents += booking.Documents()
+	}
+
+	if mode == outputPDF && documents != 1 {
+		http.Error(w, fmt.Sprintf("output=pdf requires exactly one document (one passenger or combined: only), got %d; use output=zip", documents), http.StatusBadRequest)
+		return
+	}
+
+	files, err := gen.Render(r.Context(), requestData)
+	if err != nil {
+		log.Printf("Failed to render PDFs: %v", err)
+		http.Error(w, fmt.Sprintf("Failed to render PDF: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	if mode == outputPDF {
+		writePDF(w, files[0])
+		return
+	}
+
+	name := "tickets.zip"
+	if len(requestData) == 1 {
+		name = fmt.Sprintf("%d-tickets.zip", requestData[0].Ticket.ID)
 	}
+	writeZIP(w, name, files)
 }
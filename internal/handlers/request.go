@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"pdf-microservice/internal/generator"
+	"pdf-microservice/internal/models"
+	"pdf-microservice/internal/validation"
+)
+
+type validationErrorResponse struct {
+	Errors []validation.FieldError `json:"errors"`
+}
+
+// decodeRequest разбирает и проверяет тело запроса генерации.
+// На некорректный JSON отвечает 400, на ошибки в данных - 422 со списком полей
+func decodeRequest(w http.ResponseWriter, r *http.Request, gen *generator.Generator) ([]models.RequestData, bool) {
+
+	var requestData []models.RequestData
+
+	if err := json.NewDecoder(r.Body).Decode(&requestData); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	fieldErrors := validation.Validate(requestData)
+	for i, booking := range requestData {
+		if !gen.SupportsDocument(booking.Document()) {
+			fieldErrors = append(fieldErrors, validation.FieldError{
+				Field:   fmt.Sprintf("[%d].document_type", i),
+				Message: fmt.Sprintf("unsupported document type %q", booking.DocumentType),
+			})
+		}
+		for _, fieldError := range gen.Check(booking) {
+			fieldError.Field = fmt.Sprintf("[%d].%s", i, fieldError.Field)
+			fieldErrors = append(fieldErrors, fieldError)
+		}
+	}
+
+	if len(fieldErrors) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		if err := json.NewEncoder(w).Encode(validationErrorResponse{Errors: fieldErrors}); err != nil {
+			log.Printf("Failed to encode JSON response: %v", err)
+		}
+		return nil, false
+	}
+
+	return requestData, true
+}
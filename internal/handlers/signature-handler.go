@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"pdf-microservice/internal/signing"
+)
+
+// maxVerifyBody - предельный размер проверяемого PDF
+const maxVerifyBody = 20 << 20
+
+// VerifySignatureHandler проверяет подпись PDF из тела запроса и сообщает, к какому бронированию
+// он относится. signer может быть nil - тогда подпись проверяется, но trusted всегда false
+func VerifySignatureHandler(signer *signing.Signer) http.HandlerFunc {
+	var trusted []*x509.Certificate
+	if signer != nil {
+		trusted = append(trusted, signer.Certificate())
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxVerifyBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, "PDF is too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if len(data) == 0 {
+			http.Error(w, "Empty request body, expected a PDF", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.NewEncoder(w).Encode(signing.Verify(data, trusted)); err != nil {
+			log.Printf("Failed to encode JSON response: %v", err)
+		}
+	}
+}
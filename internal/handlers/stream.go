@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"archive/zip"
+	"fmt"
+	"log"
+	"net/http"
+	"pdf-microservice/internal/models"
+	"strconv"
+	"strings"
+)
+
+const (
+	outputJSON = "json"
+	outputPDF  = "pdf"
+	outputZIP  = "zip"
+)
+
+// outputMode определяет формат ответа: параметр ?output= приоритетнее заголовка Accept
+func outputMode(r *http.Request) (string, error) {
+	switch mode := strings.ToLower(r.URL.Query().Get("output")); mode {
+	case "":
+	case outputJSON, outputPDF, outputZIP:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown output mode %q, expected one of json, pdf, zip", mode)
+	}
+
+	accept := r.Header.Get("Accept")
+	switch {
+	case strings.Contains(accept, "application/pdf"):
+		return outputPDF, nil
+	case strings.Contains(accept, "application/zip"):
+		return outputZIP, nil
+	default:
+		return outputJSON, nil
+	}
+}
+
+func writePDF(w http.ResponseWriter, file *models.File) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", file.Filename))
+	w.Header().Set("Content-Length", strconv.Itoa(len(file.Bytes)))
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(file.Bytes); err != nil {
+		log.Printf("Failed to write PDF response: %v", err)
+	}
+}
+
+// writeZIP пишет архив прямо в ответ, не собирая его целиком в памяти
+func writeZIP(w http.ResponseWriter, name string, files []*models.File) {
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		entry, err := zw.Create(file.Filename)
+		if err != nil {
+			log.Printf("Failed to add %s to zip: %v", file.Filename, err)
+			return
+		}
+		if _, err = entry.Write(file.Bytes); err != nil {
+			log.Printf("Failed to write %s to zip: %v", file.Filename, err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("Failed to finalize zip: %v", err)
+	}
+}
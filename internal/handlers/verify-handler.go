@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"log"
+	"net/http"
+	"pdf-microservice/internal/qrtoken"
+)
+
+type verifyTokenResponse struct {
+	Valid bool `json:"valid"`
+	*qrtoken.Claims
+	Error string `json:"error,omitempty"`
+}
+
+// VerifyTokenHandler проверяет токен из QR-кода документа и возвращает бронирование и пассажира.
+// Неразборчивый токен - 400, неверная подпись - 422, issuer = nil - токены не настроены, 404
+func VerifyTokenHandler(issuer *qrtoken.Issuer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		if issuer == nil {
+			http.Error(w, "Token verification is not configured", http.StatusNotFound)
+			return
+		}
+
+		response := verifyTokenResponse{}
+		status := http.StatusOK
+
+		claims, err := issuer.Parse(chi.URLParam(r, "token"))
+		switch {
+		case errors.Is(err, qrtoken.ErrSignature):
+			status = http.StatusUnprocessableEntity
+			response.Error = err.Error()
+		case err != nil:
+			status = http.StatusBadRequest
+			response.Error = err.Error()
+		default:
+			response.Valid = true
+			response.Claims = &claims
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		if err = json.NewEncoder(w).Encode(response); err != nil {
+			log.Printf("Failed to encode JSON response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"path"
+	"pdf-microservice/internal/money"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//go:embed locales/*.json
+var localesFS embed.FS
+
+const DefaultLocale = "en"
+
+// Catalog - подписи, названия месяцев и дней недели для одного языка
+type Catalog struct {
+	Locale string `json:"-"`
+	// Months - в именительном падеже ("январь"), MonthsGenitive - для дат с числом ("22 января")
+	Months         []string          `json:"months"`
+	MonthsGenitive []string          `json:"months_genitive"`
+	MonthsShort    []string          `json:"months_short"`
+	Weekdays       []string          `json:"weekdays"` // начиная с воскресенья, как time.Weekday
+	WeekdaysShort  []string          `json:"weekdays_short"`
+	Number         NumberFormat      `json:"number"`
+	Messages       map[string]string `json:"messages"`
+
+	tag      language.Tag
+	fallback *Catalog
+}
+
+// NumberFormat - разделители разрядов и дробной части и положение знака валюты
+type NumberFormat struct {
+	Decimal string `json:"decimal"`
+	Group   string `json:"group"`
+	// Currency - шаблон суммы с валютой: "{symbol}{amount}" или "{amount} {symbol}"
+	Currency string `json:"currency"`
+}
+
+var catalogs = mustLoad()
+
+func mustLoad() map[string]*Catalog {
+	loaded, err := load()
+	if err != nil {
+		panic(err)
+	}
+	return loaded
+}
+
+func load() (map[string]*Catalog, error) {
+	entries, err := localesFS.ReadDir("locales")
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string]*Catalog, len(entries))
+	for _, entry := range entries {
+		data, err := localesFS.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var catalog Catalog
+		if err = json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("locale %s: %w", entry.Name(), err)
+		}
+		if len(catalog.Months) != 12 || len(catalog.MonthsShort) != 12 || len(catalog.Weekdays) != 7 || len(catalog.WeekdaysShort) != 7 {
+			return nil, fmt.Errorf("locale %s: expected 12 months and 7 weekdays", entry.Name())
+		}
+		if catalog.Number.Decimal == "" || !strings.Contains(catalog.Number.Currency, "{amount}") {
+			return nil, fmt.Errorf("locale %s: number format needs decimal separator and {amount} in currency", entry.Name())
+		}
+		if catalog.MonthsGenitive == nil {
+			catalog.MonthsGenitive = catalog.Months
+		}
+
+		catalog.Locale = strings.TrimSuffix(entry.Name(), ".json")
+		catalog.tag = language.Make(catalog.Locale)
+		loaded[catalog.Locale] = &catalog
+	}
+
+	fallback, ok := loaded[DefaultLocale]
+	if !ok {
+		return nil, fmt.Errorf("default locale %s is missing", DefaultLocale)
+	}
+	for locale, catalog := range loaded {
+		if locale != DefaultLocale {
+			catalog.fallback = fallback
+		}
+	}
+
+	return loaded, nil
+}
+
+// Locales возвращает отсортированный список поддерживаемых языков
+func Locales() []string {
+	locales := make([]string, 0, len(catalogs))
+	for locale := range catalogs {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Normalize приводит локаль вида "ru-RU" или "RU" к поддерживаемому языку, неизвестные - к английскому
+func Normalize(locale string) string {
+	base := strings.ToLower(strings.SplitN(strings.ReplaceAll(locale, "_", "-"), "-", 2)[0])
+	if _, ok := catalogs[base]; ok {
+		return base
+	}
+	return DefaultLocale
+}
+
+func Get(locale string) *Catalog {
+	return catalogs[Normalize(locale)]
+}
+
+// T возвращает подпись по ключу, при отсутствии перевода - английскую, при отсутствии и её - сам ключ
+func (c *Catalog) T(key string) string {
+	if message, ok := c.Messages[key]; ok {
+		return message
+	}
+	if c.fallback != nil {
+		return c.fallback.T(key)
+	}
+	return key
+}
+
+// DayShift подписывает смену даты при прилёте ("+1 day"), для нуля возвращает пустую строку
+func (c *Catalog) DayShift(days int) string {
+	switch days {
+	case 0:
+		return ""
+	case 1, -1:
+		return fmt.Sprintf(c.T("day_shift"), days)
+	default:
+		return fmt.Sprintf(c.T("day_shift_plural"), days)
+	}
+}
+
+// Duration форматирует длительность в часах и минутах ("2h 05m")
+func (c *Catalog) Duration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	return fmt.Sprintf(c.T("duration"), int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+// Meal переводит код питания IATA ("B", "L", "D"...), неизвестные коды выводятся как есть
+func (c *Catalog) Meal(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		return c.T("not_available")
+	}
+	if message := c.T("meal_" + code); message != "meal_"+code {
+		return message
+	}
+	return code
+}
+
+// Baggage переводит норму багажа "1PC" или "23KG", другие значения выводятся как есть
+func (c *Catalog) Baggage(allowance string) string {
+	allowance = strings.ToUpper(strings.ReplaceAll(allowance, " ", ""))
+	if allowance == "" {
+		return c.T("not_available")
+	}
+	if pieces, ok := strings.CutSuffix(allowance, "PC"); ok {
+		if amount, err := strconv.Atoi(pieces); err == nil {
+			return fmt.Sprintf(c.T("baggage_pieces"), amount)
+		}
+	}
+	if kilograms, ok := strings.CutSuffix(allowance, "KG"); ok {
+		if amount, err := strconv.Atoi(kilograms); err == nil {
+			return fmt.Sprintf(c.T("baggage_kg"), amount)
+		}
+	}
+	return allowance
+}
+
+// FormatMoney форматирует сумму по правилам языка: "€1,234.50", "1 234,50 ₽".
+// Буквенный знак ("CHF", "Kč") отделяется от числа пробелом, чтобы не слипался с цифрами
+func (c *Catalog) FormatMoney(amount money.Amount, symbol string) string {
+	integer, fraction := amount.Parts()
+
+	var number strings.Builder
+	for i, digit := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			number.WriteString(c.Number.Group)
+		}
+		number.WriteRune(digit)
+	}
+	if fraction != "" {
+		number.WriteString(c.Number.Decimal + fraction)
+	}
+
+	pattern := c.Number.Currency
+	symbolRunes := []rune(symbol)
+	if len(symbolRunes) > 0 {
+		if strings.Contains(pattern, "{symbol}{amount}") && unicode.IsLetter(symbolRunes[len(symbolRunes)-1]) {
+			pattern = strings.Replace(pattern, "{symbol}{amount}", "{symbol}\u00a0{amount}", 1)
+		}
+		if strings.Contains(pattern, "{amount}{symbol}") && unicode.IsLetter(symbolRunes[0]) {
+			pattern = strings.Replace(pattern, "{amount}{symbol}", "{amount}\u00a0{symbol}", 1)
+		}
+	}
+
+	return strings.NewReplacer("{amount}", number.String(), "{symbol}", symbol).Replace(pattern)
+}
+
+func (c *Catalog) Upper(s string) string {
+	return cases.Upper(c.tag).String(s)
+}
+
+// Названия в макете даты заменяются служебными символами до time.Format, чтобы тот их не тронул
+var dateTokens = []string{"Monday", "January", "Mon", "Jan"}
+
+// FormatDate форматирует дату по макету Go, подставляя названия месяцев и дней недели языка каталога
+func (c *Catalog) FormatDate(layout string, t time.Time) string {
+	for i, token := range dateTokens {
+		layout = strings.ReplaceAll(layout, token, string(rune(i+1)))
+	}
+
+	months := c.Months
+	if strings.Contains(layout, "02") || strings.Contains(layout, "_2") {
+		months = c.MonthsGenitive
+	}
+
+	return strings.NewReplacer(
+		"\x01", c.Weekdays[t.Weekday()],
+		"\x02", months[t.Month()-1],
+		"\x03", c.WeekdaysShort[t.Weekday()],
+		"\x04", c.MonthsShort[t.Month()-1],
+	).Replace(t.Format(layout))
+}
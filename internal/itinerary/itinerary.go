@@ -0,0 +1,100 @@
+package itinerary
+
+import (
+	"fmt"
+	"pdf-microservice/internal/airports"
+	"pdf-microservice/internal/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layover - пересадка между двумя соседними сегментами
+type Layover struct {
+	// Airport - аэропорт прилёта, NextAirport - аэропорт следующего вылета
+	Airport     string
+	NextAirport string
+	Duration    time.Duration
+	// AirportChange - следующий рейс вылетает из другого аэропорта
+	AirportChange bool
+}
+
+// Timing - длительности, рассчитанные по временам сегментов
+type Timing struct {
+	// Flights - время в полёте для каждого сегмента
+	Flights []time.Duration
+	// Layovers - пересадки, на одну меньше, чем сегментов
+	Layovers []Layover
+	// Total - от первого вылета до последнего прилёта
+	Total time.Duration
+	// Exact - все аэропорты есть в таблице часовых поясов. Иначе времена сравниваются без учёта поясов
+	// и длительности приблизительны
+	Exact bool
+}
+
+// Compute рассчитывает время полёта, пересадки и общую длительность маршрута
+func Compute(segments []models.Segments) (Timing, error) {
+	timing := Timing{Exact: true}
+	if len(segments) == 0 {
+		return timing, nil
+	}
+
+	departures := make([]time.Time, len(segments))
+	arrivals := make([]time.Time, len(segments))
+	for i, segment := range segments {
+		var known bool
+		var err error
+		departures[i], known, err = airports.ParseLocalTime(segment.DepartureTime, segment.DepartureAirport)
+		if err != nil {
+			return Timing{}, fmt.Errorf("segment %d: invalid departure time: %w", i, err)
+		}
+		timing.Exact = timing.Exact && known
+
+		arrivals[i], known, err = airports.ParseLocalTime(segment.ArrivalTime, segment.ArrivalAirport)
+		if err != nil {
+			return Timing{}, fmt.Errorf("segment %d: invalid arrival time: %w", i, err)
+		}
+		timing.Exact = timing.Exact && known
+
+		timing.Flights = append(timing.Flights, arrivals[i].Sub(departures[i]))
+		if i > 0 {
+			timing.Layovers = append(timing.Layovers, Layover{
+				Airport:       segments[i-1].ArrivalAirport,
+				NextAirport:   segment.DepartureAirport,
+				Duration:      departures[i].Sub(arrivals[i-1]),
+				AirportChange: segments[i-1].ArrivalAirport != segment.DepartureAirport,
+			})
+		}
+	}
+	timing.Total = arrivals[len(arrivals)-1].Sub(departures[0])
+
+	return timing, nil
+}
+
+// ParseDuration разбирает длительность в формате "часы:минуты" ("32:25", "1:0")
+func ParseDuration(value string) (time.Duration, error) {
+	hours, minutes, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid duration %q: expected hours:minutes", value)
+	}
+	h, err := strconv.Atoi(hours)
+	if err != nil || h < 0 {
+		return 0, fmt.Errorf("invalid duration %q: bad hours", value)
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 || m > 59 {
+		return 0, fmt.Errorf("invalid duration %q: bad minutes", value)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// FormatDuration форматирует длительность как "32:25"
+func FormatDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	d = d.Round(time.Minute)
+	return fmt.Sprintf("%s%d:%02d", sign, int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
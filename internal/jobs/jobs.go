@@ -0,0 +1,157 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"pdf-microservice/internal/models"
+	"sync"
+	"time"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusCompleted Status = "completed"
+)
+
+type Job struct {
+	ID        string                 `json:"id"`
+	Status    Status                 `json:"status"`
+	Outcome   models.OverallStatus   `json:"outcome,omitempty"`
+	CreatedAt time.Time              `json:"created_at"`
+	UpdatedAt time.Time              `json:"updated_at"`
+	Bookings  []models.BookingResult `json:"bookings"`
+}
+
+// Store - in-memory хранилище асинхронных задач генерации
+type Store struct {
+	mu   sync.RWMutex
+	jobs map[string]*Job
+	ttl  time.Duration
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{
+		jobs: make(map[string]*Job),
+		ttl:  ttl,
+	}
+}
+
+func (s *Store) Create(requestData []models.RequestData) (Job, error) {
+	id, err := newID()
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to generate job id: %w", err)
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:        id,
+		Status:    StatusQueued,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Bookings:  models.NewBookingResults(requestData),
+	}
+
+	s.mu.Lock()
+	s.jobs[id] = job
+	s.mu.Unlock()
+
+	return job.snapshot(), nil
+}
+
+// Get возвращает копию задачи, чтобы её можно было сериализовать без блокировки
+func (s *Store) Get(id string) (Job, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return job.snapshot(), true
+}
+
+// UpdateDocument обновляет статус документа пассажира или, при passenger == models.CombinedDocument, общего документа
+func (s *Store) UpdateDocument(id string, booking, passenger int, result models.DocumentResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+	job.Status = StatusRunning
+	if passenger == models.CombinedDocument {
+		*job.Bookings[booking].Combined = result
+	} else {
+		job.Bookings[booking].Passengers[passenger].DocumentResult = result
+	}
+	job.UpdatedAt = time.Now()
+}
+
+func (s *Store) Complete(id string, results []models.BookingResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return
+	}
+	job.Status = StatusCompleted
+	job.Outcome = models.NewGenerateResponse(results).Status
+	job.Bookings = results
+	job.UpdatedAt = time.Now()
+}
+
+// Cleanup удаляет завершённые задачи старше ttl
+func (s *Store) Cleanup() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, job := range s.jobs {
+		if job.Status == StatusCompleted && time.Since(job.UpdatedAt) > s.ttl {
+			delete(s.jobs, id)
+		}
+	}
+}
+
+// RunCleanup периодически вызывает Cleanup до отмены контекста
+func (s *Store) RunCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.Cleanup()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (j *Job) snapshot() Job {
+	cp := *j
+	cp.Bookings = make([]models.BookingResult, len(j.Bookings))
+	for i, booking := range j.Bookings {
+		cp.Bookings[i] = booking
+		cp.Bookings[i].Passengers = append([]models.PassengerResult{}, booking.Passengers...)
+		if booking.Combined != nil {
+			combined := *booking.Combined
+			cp.Bookings[i].Combined = &combined
+		}
+	}
+	return cp
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,339 @@
+package logos
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxLogoSize - логотипы больше этого размера не скачиваются
+	maxLogoSize = 2 << 20
+	// retryAfter - через сколько повторять скачивание логотипа после ошибки
+	retryAfter = 10 * time.Minute
+	// maxFetches - сколько логотипов скачивается одновременно, maxPending - сколько ждут скачивания
+	maxFetches = 4
+	maxPending = 64
+	// maxRedirects - сколько перенаправлений проходит скачивание
+	maxRedirects = 3
+	// maxImages - сколько логотипов и ошибок скачивания хранится в памяти,
+	// maxFiles - сколько логотипов в дисковом кэше, fileTTL - через сколько логотип на диске скачивается заново
+	maxImages = 512
+	maxFiles  = 4096
+	fileTTL   = 30 * 24 * time.Hour
+)
+
+// Image - картинка в формате, который понимает fpdf
+type Image struct {
+	Data []byte
+	// Type - png, jpg или gif
+	Type string
+}
+
+// Source скачивает картинку по URL
+type Source interface {
+	Fetch(ctx context.Context, url string) ([]byte, error)
+}
+
+// HTTPSource скачивает картинки по HTTPS только с разрешённых хостов: URL логотипа приходит в запросе,
+// и без списка хостов сервис можно было бы заставить обращаться к внутренней сети
+type HTTPSource struct {
+	client *http.Client
+	hosts  map[string]bool
+}
+
+// NewHTTPSource создаёт источник, hosts - хосты, с которых разрешено скачивать логотипы
+func NewHTTPSource(timeout time.Duration, hosts []string) *HTTPSource {
+	s := &HTTPSource{hosts: make(map[string]bool, len(hosts))}
+	for _, host := range hosts {
+		s.hosts[strings.ToLower(host)] = true
+	}
+	s.client = &http.Client{
+		Timeout: timeout,
+		// Перенаправление не должно уводить с разрешённых хостов
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return s.allowed(req.URL)
+		},
+	}
+	return s
+}
+
+func (s *HTTPSource) allowed(u *url.URL) error {
+	if u.Scheme != "https" || (u.Port() != "" && u.Port() != "443") || !s.hosts[strings.ToLower(u.Hostname())] {
+		return fmt.Errorf("logo url %s is not on an allowed https host", u.Redacted())
+	}
+	return nil
+}
+
+func (s *HTTPSource) Fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid logo url: %w", err)
+	}
+	if err := s.allowed(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", rawURL, resp.Status)
+	}
+	if resp.ContentLength > maxLogoSize {
+		return nil, fmt.Errorf("logo %s is larger than %d bytes", rawURL, maxLogoSize)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxLogoSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", rawURL, err)
+	}
+	if len(data) > maxLogoSize {
+		return nil, fmt.Errorf("logo %s is larger than %d bytes", rawURL, maxLogoSize)
+	}
+	return data, nil
+}
+
+// Cache отдаёт логотипы перевозчиков без обращения к сети: из памяти, с диска или из каталога
+// с логотипами по коду IATA. Если логотипа по URL ещё нет, он скачивается в фоне и появится
+// в следующих документах. URL приходят в запросах, поэтому память и диск ограничены: в памяти
+// maxImages последних логотипов и ошибок, на диске - maxFiles файлов не старше fileTTL
+type Cache struct {
+	source   Source
+	cacheDir string
+
+	mu       sync.Mutex
+	images   *lru[Image]
+	fallback map[string]Image
+	pending  map[string]bool
+	failed   *lru[time.Time]
+	sem      chan struct{}
+}
+
+// NewCache создаёт кэш. source может быть nil - тогда логотипы берутся только из кэша и fallbackDir.
+// cacheDir - каталог дискового кэша, пустой - только память. fallbackDir - каталог с файлами вида SU.png
+func NewCache(source Source, cacheDir, fallbackDir string) (*Cache, error) {
+	c := &Cache{
+		source:   source,
+		cacheDir: cacheDir,
+		images:   newLRU[Image](maxImages),
+		fallback: make(map[string]Image),
+		pending:  make(map[string]bool),
+		failed:   newLRU[time.Time](maxImages),
+		sem:      make(chan struct{}, maxFetches),
+	}
+
+	if cacheDir != "" {
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create logo cache directory: %w", err)
+		}
+	}
+
+	if fallbackDir != "" {
+		if err := c.loadFallback(fallbackDir); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Cache) loadFallback(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("Logo fallback directory %s not found, carriers without cached logos are printed as text", dir)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read logo fallback directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read logo %s: %w", entry.Name(), err)
+		}
+		logo, ok := newImage(data)
+		if !ok {
+			log.Printf("Skipping logo %s: not a png, jpeg or gif image", entry.Name())
+			continue
+		}
+		carrier := strings.ToUpper(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())))
+		c.fallback[carrier] = logo
+	}
+
+	return nil
+}
+
+// Logo возвращает логотип по URL, а если его нет в кэше - логотип из каталога по коду перевозчика.
+// Не блокируется на сети
+func (c *Cache) Logo(carrier, url string) (Image, bool) {
+	if url != "" {
+		if logo, ok := c.cached(url); ok {
+			return logo, true
+		}
+		c.fetchAsync(url)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	logo, ok := c.fallback[strings.ToUpper(carrier)]
+	return logo, ok
+}
+
+func (c *Cache) cached(url string) (Image, bool) {
+	c.mu.Lock()
+	logo, ok := c.images.get(url)
+	c.mu.Unlock()
+	if ok || c.cacheDir == "" {
+		return logo, ok
+	}
+
+	path := c.cachePath(url)
+	if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > fileTTL {
+		// Устаревший логотип скачивается заново
+		os.Remove(path)
+		return Image{}, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Error reading cached logo %s: %v", url, err)
+		}
+		return Image{}, false
+	}
+	logo, ok = newImage(data)
+	if !ok {
+		return Image{}, false
+	}
+
+	c.mu.Lock()
+	c.images.put(url, logo)
+	c.mu.Unlock()
+	return logo, true
+}
+
+func (c *Cache) fetchAsync(url string) {
+	if c.source == nil {
+		return
+	}
+
+	c.mu.Lock()
+	failedAt, failed := c.failed.get(url)
+	if c.pending[url] || len(c.pending) >= maxPending || (failed && time.Since(failedAt) < retryAfter) {
+		c.mu.Unlock()
+		return
+	}
+	c.pending[url] = true
+	c.mu.Unlock()
+
+	go func() {
+		c.sem <- struct{}{}
+		defer func() { <-c.sem }()
+
+		logo, err := c.fetch(url)
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		delete(c.pending, url)
+		if err != nil {
+			log.Printf("Error fetching logo: %v", err)
+			c.failed.put(url, time.Now())
+			return
+		}
+		c.failed.remove(url)
+		c.images.put(url, logo)
+	}()
+}
+
+func (c *Cache) fetch(url string) (Image, error) {
+	data, err := c.source.Fetch(context.Background(), url)
+	if err != nil {
+		return Image{}, err
+	}
+	logo, ok := newImage(data)
+	if !ok {
+		return Image{}, fmt.Errorf("logo %s is not a png, jpeg or gif image", url)
+	}
+
+	if c.cacheDir != "" {
+		if err := os.WriteFile(c.cachePath(url), data, 0644); err != nil {
+			log.Printf("Error caching logo %s: %v", url, err)
+		}
+		c.pruneFiles()
+	}
+	return logo, nil
+}
+
+// pruneFiles удаляет из дискового кэша самые старые логотипы сверх maxFiles
+func (c *Cache) pruneFiles() {
+	entries, err := os.ReadDir(c.cacheDir)
+	if err != nil || len(entries) <= maxFiles {
+		return
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if info, err := entry.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ModTime().Before(infos[j].ModTime()) })
+	for _, info := range infos[:max(len(infos)-maxFiles, 0)] {
+		if err := os.Remove(filepath.Join(c.cacheDir, info.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Error removing cached logo %s: %v", info.Name(), err)
+		}
+	}
+}
+
+func (c *Cache) cachePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(c.cacheDir, hex.EncodeToString(sum[:]))
+}
+
+// newImage проверяет, что данные - картинка, которую fpdf сможет вывести
+func newImage(data []byte) (Image, bool) {
+	_, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, false
+	}
+	switch format {
+	case "png", "gif":
+		return Image{Data: data, Type: format}, true
+	case "jpeg":
+		return Image{Data: data, Type: "jpg"}, true
+	default:
+		return Image{}, false
+	}
+}
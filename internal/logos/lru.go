@@ -0,0 +1,51 @@
+package logos
+
+import "container/list"
+
+// lru - словарь ограниченного размера: при переполнении вытесняется запись, к которой дольше всего
+// не обращались. Не потокобезопасен, Cache обращается к нему под своим мьютексом
+type lru[V any] struct {
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+func newLRU[V any](size int) *lru[V] {
+	return &lru[V]{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (l *lru[V]) get(key string) (V, bool) {
+	element, ok := l.entries[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	l.order.MoveToFront(element)
+	return element.Value.(*lruEntry[V]).value, true
+}
+
+func (l *lru[V]) put(key string, value V) {
+	if element, ok := l.entries[key]; ok {
+		element.Value.(*lruEntry[V]).value = value
+		l.order.MoveToFront(element)
+		return
+	}
+	l.entries[key] = l.order.PushFront(&lruEntry[V]{key: key, value: value})
+	if l.order.Len() > l.size {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.entries, oldest.Value.(*lruEntry[V]).key)
+	}
+}
+
+func (l *lru[V]) remove(key string) {
+	if element, ok := l.entries[key]; ok {
+		l.order.Remove(element)
+		delete(l.entries, key)
+	}
+}
@@ -2,32 +2,48 @@ package models
 
 import (
 	"fmt"
-	"pdf-microservice/internal/options"
 	"strings"
 )
 
 type File struct {
 	Filename string
-	S3URL    string
+	URL      string
 	Bytes    []byte
 }
 
-func NewFile(ID int, FirstName string, LastName string, cfg *options.Config) *File {
-
-	filename := fmt.Sprintf("%d-%s-%s.pdf", ID, FirstName, LastName)
-
-	return &File{
-		Filename: filename,
-		S3URL:    CreateURL(cfg, filename),
+// Filenames возвращает имена файлов для пассажиров бронирования в порядке User.Passengers.
+// У детей и младенцев в имени есть тип пассажира, тёзки в одном бронировании получают суффикс -2, -3 и т.д.
+func Filenames(booking RequestData) []string {
+	passengers := booking.User.Passengers()
+	filenames := make([]string, len(passengers))
+	used := make(map[string]bool, len(passengers))
+
+	for i, passenger := range passengers {
+		parts := []string{fmt.Sprint(booking.Ticket.ID), passenger.FirstName, passenger.LastName}
+		if passenger.Type != PassengerAdult {
+			parts = append(parts, passenger.Type)
+		}
+		if booking.Document() != DocumentETicket {
+			parts = append(parts, booking.Document())
+		}
+
+		base := strings.Join(parts, "-")
+		filename := base + ".pdf"
+		for n := 2; used[strings.ToLower(filename)]; n++ {
+			filename = fmt.Sprintf("%s-%d.pdf", base, n)
+		}
+		used[strings.ToLower(filename)] = true
+		filenames[i] = filename
 	}
 
+	return filenames
 }
 
-func CreateURL(cfg *options.Config, filename string) string {
-
-	url := []string{"https:", cfg.S3.Endpoint, cfg.S3.BucketName, "tickets", filename}
-
-	s3Url := strings.Join(url, "/")
-
-	return s3Url
+// BookingFilename возвращает имя общего документа бронирования: {id}-booking.pdf
+func BookingFilename(booking RequestData) string {
+	parts := []string{fmt.Sprint(booking.Ticket.ID), "booking"}
+	if booking.Document() != DocumentETicket {
+		parts = append(parts, booking.Document())
+	}
+	return strings.Join(parts, "-") + ".pdf"
 }
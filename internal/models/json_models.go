@@ -1,10 +1,99 @@
 package models
 
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	DocumentETicket      = "eticket"
+	DocumentInvoice      = "invoice"
+	DocumentBoardingPass = "boarding_pass"
+)
+
 type RequestData struct {
+	// DocumentType - тип документа: eticket (по умолчанию), invoice или boarding_pass
+	DocumentType string `json:"document_type"`
+	// Locale - язык документа: ru, en, tr или de, по умолчанию и для неизвестных языков - en
+	Locale string `json:"locale"`
+	// Combined - общий документ бронирования со всеми пассажирами: пусто (не нужен), alongside (вместе
+	// с документами пассажиров) или only (вместо них). Счёт всегда один на бронирование
+	Combined string `json:"combined"`
+	// Protection - защита документов бронирования паролем, если не передана - как в конфиге
+	Protection *Protection `json:"protection"`
+	// PDFA - выпускать документы в PDF/A-3b с данными бронирования во вложении, если не передан - как в конфиге
+	PDFA   *bool  `json:"pdfa"`
 	Ticket Ticket `json:"ticket"`
 	User   User   `json:"user"`
 }
 
+// Protection - шифрование документа. Enabled не передан - защита включается, если передан пароль
+// или она включена в конфиге. Без Password паролем служит номер бронирования, если это разрешено в конфиге,
+// иначе защищённый документ отклоняется
+type Protection struct {
+	Enabled  *bool  `json:"enabled"`
+	Password string `json:"password"`
+}
+
+// Document возвращает тип документа с учётом значения по умолчанию
+func (r RequestData) Document() string {
+	if r.DocumentType == "" {
+		return DocumentETicket
+	}
+	return r.DocumentType
+}
+
+// ForPassenger возвращает бронирование только с этим пассажиром, без защиты паролем. Младенец остаётся
+// вместе с сопровождающим взрослым, чтобы бронирование проходило проверку
+func (r RequestData) ForPassenger(passenger Passenger) RequestData {
+	single := r
+	single.Protection = nil
+	single.Combined = CombinedNone
+	single.User.Adults, single.User.Children, single.User.Infants = nil, nil, nil
+	switch passenger.Type {
+	case PassengerChild:
+		single.User.Children = []Adult{passenger.Adult}
+	case PassengerInfant:
+		infant := Infant{Adult: passenger.Adult}
+		if passenger.AccompaniedBy != nil {
+			single.User.Adults = []Adult{*passenger.AccompaniedBy}
+		}
+		single.User.Infants = []Infant{infant}
+	default:
+		single.User.Adults = []Adult{passenger.Adult}
+	}
+	return single
+}
+
+const (
+	CombinedNone      = ""
+	CombinedAlongside = "alongside"
+	CombinedOnly      = "only"
+)
+
+// Individual сообщает, нужны ли отдельные документы пассажиров. Счёт выставляется плательщику
+// на всё бронирование, поэтому отдельных счетов по пассажирам нет
+func (r RequestData) Individual() bool {
+	return r.Combined != CombinedOnly && r.Document() != DocumentInvoice
+}
+
+// HasCombined сообщает, нужен ли общий документ бронирования. Для счёта он нужен всегда
+func (r RequestData) HasCombined() bool {
+	return r.Combined == CombinedAlongside || r.Combined == CombinedOnly || r.Document() == DocumentInvoice
+}
+
+// Documents возвращает число документов, которые выпускаются по бронированию
+func (r RequestData) Documents() int {
+	documents := 0
+	if r.Individual() {
+		documents = len(r.User.Passengers())
+	}
+	if r.HasCombined() {
+		documents++
+	}
+	return documents
+}
+
 type Ticket struct {
 	ID               int           `json:"id"`
 	Price            string        `json:"price"`
@@ -16,6 +105,34 @@ type Ticket struct {
 	StartCountryName string        `json:"start_country_name"`
 	FinalCityName    string        `json:"final_city_name"`
 	FinalCountryName string        `json:"final_country_name"`
+	// Fare - разбивка стоимости на тариф, сборы и комиссии, необязательна
+	Fare *Fare `json:"fare"`
+	// PaymentStatus - paid, partially_paid или unpaid, если не передан - статус не выводится
+	PaymentStatus string `json:"payment_status"`
+	// AmountPaid - уже внесённая сумма, обязательна для partially_paid
+	AmountPaid string `json:"amount_paid"`
+}
+
+const (
+	PaymentPaid          = "paid"
+	PaymentPartiallyPaid = "partially_paid"
+	PaymentUnpaid        = "unpaid"
+)
+
+// Fare - стоимость всего бронирования в валюте ticket.currency, суммы - десятичные строки как price
+type Fare struct {
+	BaseFare string     `json:"base_fare"`
+	Taxes    []FareItem `json:"taxes"`
+	Fees     []FareItem `json:"fees"`
+	// Total - итог, если не передан - считается как сумма тарифа, сборов и комиссий
+	Total string `json:"total"`
+}
+
+// FareItem - сбор или комиссия, Code - код сбора ("YQ", "RU"), Name - подпись для документа
+type FareItem struct {
+	Code   string `json:"code"`
+	Name   string `json:"name"`
+	Amount string `json:"amount"`
 }
 
 type Itineraries struct {
@@ -30,6 +147,7 @@ type Segments struct {
 	DepartureAirport     string `json:"departure_airport"`
 	ArrivalAirport       string `json:"arrival_airport"`
 	Carrier              string `json:"carrier"`
+	FlightNumber         string `json:"flight_number"`
 	CarrierName          string `json:"carrier_name"`
 	CarrierLogo          string `json:"carrier_logo"`
 	Duration             string `json:"duration"`
@@ -37,12 +155,101 @@ type Segments struct {
 	DepartureCountryName string `json:"departure_country_name"`
 	ArrivalCityName      string `json:"arrival_city_name"`
 	ArrivalCountryName   string `json:"arrival_country_name"`
+	// Aircraft - тип воздушного судна, например "Airbus A321"
+	Aircraft string `json:"aircraft"`
+	// Distance - расстояние в милях, если не передано - считается по координатам аэропортов
+	Distance int `json:"distance"`
+	// Meal - код питания IATA: B, L, D, S, M и т.д.
+	Meal string `json:"meal"`
+	// Baggage - норма багажа: "1PC", "23KG"
+	Baggage string `json:"baggage"`
+	Seats   []Seat `json:"seats"`
+}
+
+// Seat - место пассажира на сегменте, пассажир определяется по имени и фамилии
+type Seat struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Seat      string `json:"seat"`
+}
+
+// Flight возвращает код перевозчика и номер рейса. Если flight_number не передан,
+// номер берётся из carrier вида "SU1234"
+func (s Segments) Flight() (carrier string, number string) {
+	if s.FlightNumber != "" {
+		return s.Carrier, s.FlightNumber
+	}
+	for i := 2; i < len(s.Carrier); i++ {
+		if unicode.IsDigit(rune(s.Carrier[i])) {
+			return s.Carrier[:i], s.Carrier[i:]
+		}
+	}
+	return s.Carrier, ""
+}
+
+// SeatFor возвращает место пассажира на сегменте или пустую строку, если место не назначено
+func (s Segments) SeatFor(firstName, lastName string) string {
+	for _, seat := range s.Seats {
+		if strings.EqualFold(seat.FirstName, firstName) && strings.EqualFold(seat.LastName, lastName) {
+			return seat.Seat
+		}
+	}
+	return ""
 }
 
+const (
+	PassengerAdult  = "adult"
+	PassengerChild  = "child"
+	PassengerInfant = "infant"
+)
+
 type User struct {
 	Email       string  `json:"email"`
 	PhoneNumber string  `json:"phone_number"`
 	Adults      []Adult `json:"adults"`
+	// Children - дети от 2 до 11 лет с собственным местом
+	Children []Adult `json:"children"`
+	// Infants - младенцы до 2 лет без места, на руках у взрослого
+	Infants []Infant `json:"infants"`
+}
+
+// Infant - младенец, AccompaniedBy - индекс сопровождающего взрослого в adults
+type Infant struct {
+	Adult
+	AccompaniedBy int `json:"accompanied_by"`
+}
+
+// Passenger - пассажир любого типа, на каждого выписывается отдельный документ
+type Passenger struct {
+	Adult
+	// Type - adult, child или infant
+	Type string
+	// AccompaniedBy - сопровождающий взрослый для младенца, nil для остальных
+	AccompaniedBy *Adult
+	// Index - номер пассажира в списке Passengers
+	Index int
+}
+
+// Passengers возвращает всех пассажиров бронирования: сначала взрослых, затем детей и младенцев
+func (u User) Passengers() []Passenger {
+	passengers := make([]Passenger, 0, len(u.Adults)+len(u.Children)+len(u.Infants))
+	for _, adult := range u.Adults {
+		passengers = append(passengers, Passenger{Adult: adult, Type: PassengerAdult})
+	}
+	for _, child := range u.Children {
+		passengers = append(passengers, Passenger{Adult: child, Type: PassengerChild})
+	}
+	for _, infant := range u.Infants {
+		passenger := Passenger{Adult: infant.Adult, Type: PassengerInfant}
+		if infant.AccompaniedBy >= 0 && infant.AccompaniedBy < len(u.Adults) {
+			passenger.AccompaniedBy = &u.Adults[infant.AccompaniedBy]
+		}
+		passengers = append(passengers, passenger)
+	}
+	for i := range passengers {
+		passengers[i].Index = i
+	}
+	return passengers
 }
 
 type Adult struct {
@@ -0,0 +1,157 @@
+package models
+
+import "net/http"
+
+// PassengerStatus - стадия обработки билета пассажира
+type PassengerStatus string
+
+const (
+	StatusQueued    PassengerStatus = "queued"
+	StatusRendering PassengerStatus = "rendering"
+	StatusUploading PassengerStatus = "uploading"
+	StatusDone      PassengerStatus = "done"
+	StatusFailed    PassengerStatus = "failed"
+	// StatusSpooled - загрузить не удалось, документ сохранён в локальном спуле и будет загружен позже
+	StatusSpooled PassengerStatus = "spooled"
+)
+
+// ErrorCode - машиночитаемый код ошибки, по которому клиент решает, повторять ли запрос
+type ErrorCode string
+
+const (
+	ErrCodeRenderFailed    ErrorCode = "render_failed"
+	ErrCodeLocalSaveFailed ErrorCode = "local_save_failed"
+	ErrCodeUploadFailed    ErrorCode = "upload_failed"
+)
+
+// OverallStatus - итог обработки всего запроса
+type OverallStatus string
+
+const (
+	OverallSuccess OverallStatus = "success"
+	OverallPartial OverallStatus = "partial"
+	OverallFailed  OverallStatus = "failed"
+)
+
+type PassengerError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+// GenerateResponse - ответ на запрос генерации
+type GenerateResponse struct {
+	Status    OverallStatus `json:"status"`
+	Total     int           `json:"total"`
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	// Spooled - сколько из успешных документов ещё ждут загрузки в спуле
+	Spooled  int             `json:"spooled,omitempty"`
+	Bookings []BookingResult `json:"bookings"`
+}
+
+// BookingResult - результат генерации билетов для одного бронирования из запроса
+type BookingResult struct {
+	TicketID     int               `json:"ticket_id"`
+	DocumentType string            `json:"document_type"`
+	Passengers   []PassengerResult `json:"passengers"`
+	// Combined - общий документ бронирования, если он запрошен
+	Combined *DocumentResult `json:"combined,omitempty"`
+}
+
+// CombinedDocument - индекс пассажира, под которым в ProgressFunc передаётся общий документ бронирования
+const CombinedDocument = -1
+
+// DocumentResult - результат генерации одного документа
+type DocumentResult struct {
+	Status    PassengerStatus `json:"status"`
+	Filename  string          `json:"filename"`
+	LocalPath string          `json:"local_path,omitempty"`
+	URL       string          `json:"url,omitempty"`
+	// FileID - идентификатор для GET /files/{id}/url, пусто - выдача ссылок не настроена
+	FileID string          `json:"file_id,omitempty"`
+	Error  *PassengerError `json:"error,omitempty"`
+}
+
+// PassengerResult - результат генерации билета для одного пассажира
+type PassengerResult struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Type      string `json:"type"`
+	DocumentResult
+}
+
+// NewBookingResults размечает результаты по бронированиям и документам, все документы в статусе queued.
+// Если нужен только общий документ, список пассажиров пуст
+func NewBookingResults(requestData []RequestData) []BookingResult {
+	results := make([]BookingResult, len(requestData))
+	for i, booking := range requestData {
+		results[i] = BookingResult{
+			TicketID:     booking.Ticket.ID,
+			DocumentType: booking.Document(),
+			Passengers:   []PassengerResult{},
+		}
+		if booking.Individual() {
+			for _, passenger := range booking.User.Passengers() {
+				results[i].Passengers = append(results[i].Passengers, PassengerResult{
+					FirstName:      passenger.FirstName,
+					LastName:       passenger.LastName,
+					Type:           passenger.Type,
+					DocumentResult: DocumentResult{Status: StatusQueued},
+				})
+			}
+		}
+		if booking.HasCombined() {
+			results[i].Combined = &DocumentResult{Status: StatusQueued}
+		}
+	}
+	return results
+}
+
+// NewGenerateResponse подсчитывает успешные и неуспешные документы и выставляет итоговый статус
+func NewGenerateResponse(results []BookingResult) GenerateResponse {
+	response := GenerateResponse{Bookings: results}
+
+	count := func(document DocumentResult) {
+		response.Total++
+		switch document.Status {
+		case StatusDone:
+			response.Succeeded++
+		case StatusSpooled:
+			response.Succeeded++
+			response.Spooled++
+		case StatusFailed:
+			response.Failed++
+		}
+	}
+	for _, booking := range results {
+		for _, passenger := range booking.Passengers {
+			count(passenger.DocumentResult)
+		}
+		if booking.Combined != nil {
+			count(*booking.Combined)
+		}
+	}
+
+	switch {
+	case response.Failed == 0:
+		response.Status = OverallSuccess
+	case response.Succeeded == 0:
+		response.Status = OverallFailed
+	default:
+		response.Status = OverallPartial
+	}
+
+	return response
+}
+
+// HTTPStatus возвращает 200, если все билеты готовы, 207 при частичном сбое и 500, если не готов ни один
+func (r GenerateResponse) HTTPStatus() int {
+	switch r.Status {
+	case OverallFailed:
+		return http.StatusInternalServerError
+	case OverallPartial:
+		return http.StatusMultiStatus
+	default:
+		return http.StatusOK
+	}
+}
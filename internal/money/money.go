@@ -0,0 +1,117 @@
+package money
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Currency - валюта ISO 4217: знак и число знаков после запятой
+type Currency struct {
+	Code   string
+	Symbol string
+	Digits int
+}
+
+var currencies = map[string]Currency{}
+
+func init() {
+	for _, c := range []Currency{
+		{"AED", "AED", 2}, {"AMD", "֏", 2}, {"AUD", "A$", 2}, {"AZN", "₼", 2}, {"BGN", "лв", 2},
+		{"BHD", "BHD", 3}, {"BYN", "Br", 2}, {"CAD", "C$", 2}, {"CHF", "CHF", 2}, {"CNY", "¥", 2},
+		{"CZK", "Kč", 2}, {"DKK", "kr", 2}, {"EGP", "E£", 2}, {"EUR", "€", 2}, {"GBP", "£", 2},
+		{"GEL", "₾", 2}, {"HKD", "HK$", 2}, {"HUF", "Ft", 2}, {"IDR", "Rp", 2}, {"ILS", "₪", 2},
+		{"INR", "₹", 2}, {"IQD", "IQD", 3}, {"JOD", "JOD", 3}, {"JPY", "¥", 0}, {"KGS", "сом", 2},
+		{"KRW", "₩", 0}, {"KWD", "KWD", 3}, {"KZT", "₸", 2}, {"LYD", "LYD", 3}, {"MDL", "L", 2},
+		{"NOK", "kr", 2}, {"OMR", "OMR", 3}, {"PLN", "zł", 2}, {"QAR", "QAR", 2}, {"RON", "lei", 2},
+		{"RSD", "RSD", 2}, {"RUB", "₽", 2}, {"SAR", "SAR", 2}, {"SEK", "kr", 2}, {"SGD", "S$", 2},
+		{"THB", "฿", 2}, {"TJS", "TJS", 2}, {"TND", "TND", 3}, {"TRY", "₺", 2}, {"UAH", "₴", 2},
+		{"USD", "$", 2}, {"UZS", "UZS", 2}, {"VND", "₫", 0},
+	} {
+		currencies[c.Code] = c
+	}
+}
+
+// Lookup возвращает валюту по коду. Для неизвестных кодов знаком служит сам код, знаков после запятой - 2
+func Lookup(code string) (Currency, bool) {
+	code = strings.ToUpper(code)
+	currency, ok := currencies[code]
+	if !ok {
+		return Currency{Code: code, Symbol: code, Digits: 2}, false
+	}
+	return currency, true
+}
+
+// Amount - сумма в минимальных единицах валюты (центах, копейках), чтобы суммы складывались без ошибок округления
+type Amount struct {
+	Minor    int64
+	Currency string
+}
+
+// Parse разбирает неотрицательную сумму вида "471.38". Знаков после точки не больше, чем у валюты
+func Parse(value, currency string) (Amount, error) {
+	c, _ := Lookup(currency)
+
+	integer, fraction, _ := strings.Cut(strings.TrimSpace(value), ".")
+	if integer == "" || !digitsOnly(integer) || !digitsOnly(fraction) {
+		return Amount{}, fmt.Errorf("invalid amount %q", value)
+	}
+	if len(fraction) > c.Digits {
+		return Amount{}, fmt.Errorf("amount %q has more than %d decimal places for %s", value, c.Digits, c.Code)
+	}
+
+	minor, err := strconv.ParseInt(integer+fraction+strings.Repeat("0", c.Digits-len(fraction)), 10, 64)
+	if err != nil {
+		return Amount{}, fmt.Errorf("invalid amount %q: %w", value, err)
+	}
+	return Amount{Minor: minor, Currency: c.Code}, nil
+}
+
+func digitsOnly(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (a Amount) Add(b Amount) Amount {
+	return Amount{Minor: a.Minor + b.Minor, Currency: a.Currency}
+}
+
+// Split делит сумму на n равных долей, остаток в минимальных единицах достаётся первым долям
+func (a Amount) Split(n int) []Amount {
+	if n <= 0 {
+		return nil
+	}
+	shares := make([]Amount, n)
+	share, rest := a.Minor/int64(n), a.Minor%int64(n)
+	for i := range shares {
+		shares[i] = Amount{Minor: share, Currency: a.Currency}
+		if int64(i) < rest {
+			shares[i].Minor++
+		}
+	}
+	return shares
+}
+
+// Parts возвращает целую и дробную часть суммы без разделителей: "471", "38"
+func (a Amount) Parts() (integer, fraction string) {
+	c, _ := Lookup(a.Currency)
+	minor := strconv.FormatInt(a.Minor, 10)
+	if c.Digits == 0 {
+		return minor, ""
+	}
+	minor = strings.Repeat("0", max(0, c.Digits+1-len(minor))) + minor
+	return minor[:len(minor)-c.Digits], minor[len(minor)-c.Digits:]
+}
+
+// String форматирует сумму без знака валюты и разделителей групп: "471.38"
+func (a Amount) String() string {
+	integer, fraction := a.Parts()
+	if fraction == "" {
+		return integer
+	}
+	return integer + "." + fraction
+}
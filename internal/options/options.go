@@ -3,11 +3,22 @@ package options
 import (
 	"fmt"
 	"github.com/spf13/viper"
+	"time"
 )
 
 type Config struct {
-	Api Api
-	S3  S3
+	Api        Api
+	S3         S3
+	Storage    Storage
+	Jobs       Jobs
+	Logos      Logos
+	Protection Protection
+	Signing    Signing
+	PDFA       PDFA
+	Verify     Verify
+	Outbox     Outbox
+	// Layouts - пути к JSON-макетам по типам документов, переопределяют встроенные
+	Layouts map[string]string
 }
 
 type Api struct {
@@ -27,6 +38,82 @@ type S3 struct {
 	Region          string `mapstructure:"region"`
 	FilePath        string `mapstructure:"file_path"`
 	ObjectKey       string `mapstructure:"object_key "`
+	// URLExpiry - срок подписанных ссылок на скачивание, не больше 7 дней
+	URLExpiry time.Duration `mapstructure:"url_expiry"`
+}
+
+// Storage выбирает бэкенд хранения билетов: s3, local или memory. Для s3 операции повторяются
+// RetryAttempts раз с задержкой от RetryBaseDelay, удваивающейся до RetryMaxDelay, каждая попытка
+// ограничена AttemptTimeout. После BreakerFailures сбоев подряд обращения к S3 отклоняются сразу
+// в течение BreakerCooldown, 0 - без предохранителя
+type Storage struct {
+	Backend         string        `mapstructure:"backend"`
+	RetryAttempts   int           `mapstructure:"retry_attempts"`
+	RetryBaseDelay  time.Duration `mapstructure:"retry_base_delay"`
+	RetryMaxDelay   time.Duration `mapstructure:"retry_max_delay"`
+	AttemptTimeout  time.Duration `mapstructure:"attempt_timeout"`
+	BreakerFailures int           `mapstructure:"breaker_failures"`
+	BreakerCooldown time.Duration `mapstructure:"breaker_cooldown"`
+}
+
+// Jobs - асинхронные задачи. Timeout - предел генерации и загрузки всех документов задачи
+type Jobs struct {
+	TTL             time.Duration `mapstructure:"ttl"`
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+}
+
+// Logos - логотипы перевозчиков. Fetch включает фоновое скачивание по carrier_logo,
+// Hosts - хосты, с которых оно разрешено (только https), CacheDir - дисковый кэш скачанных логотипов (пусто - только память),
+// FallbackDir - логотипы по коду IATA (SU.png), если по URL логотипа ещё нет
+type Logos struct {
+	Fetch        bool          `mapstructure:"fetch"`
+	FetchTimeout time.Duration `mapstructure:"fetch_timeout"`
+	Hosts        []string      `mapstructure:"hosts"`
+	CacheDir     string        `mapstructure:"cache_dir"`
+	FallbackDir  string        `mapstructure:"fallback_dir"`
+}
+
+// Protection - защита документов паролем по умолчанию. Enabled - шифровать документы, даже если запрос
+// не просит, OwnerPassword - пароль владельца (пусто - случайный), AllowPrint - разрешить печать;
+// редактирование и копирование запрещены всегда. BookingPassword - без пароля в запросе паролем служит
+// номер бронирования, иначе пароль в запросе обязателен
+type Protection struct {
+	Enabled         bool   `mapstructure:"enabled"`
+	OwnerPassword   string `mapstructure:"owner_password"`
+	AllowPrint      bool   `mapstructure:"allow_print"`
+	BookingPassword bool   `mapstructure:"booking_password"`
+}
+
+// PDFA - выпуск документов в PDF/A-3b с данными бронирования во вложении, запрос может переопределить
+type PDFA struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+// Verify - подписанные токены в QR-кодах документов. Secret - ключ HMAC не короче 32 байт, пусто - QR
+// содержит ссылку на файл, BaseURL - внешний адрес сервиса для ссылки {base_url}/verify/{token}
+type Verify struct {
+	Secret  string `mapstructure:"secret"`
+	BaseURL string `mapstructure:"base_url"`
+}
+
+// Outbox - спул документов, которые не удалось загрузить в хранилище. Dir - каталог спула,
+// Interval - как часто выгружать спул в хранилище
+type Outbox struct {
+	Enabled  bool          `mapstructure:"enabled"`
+	Dir      string        `mapstructure:"dir"`
+	Interval time.Duration `mapstructure:"interval"`
+}
+
+// Signing - электронная подпись документов. CertFile - PEM с сертификатом подписанта и цепочкой,
+// KeyFile - PEM с закрытым ключом, Visible - видимое поле подписи на первой странице,
+// Rect - его x, y, ширина и высота в миллиметрах от левого верхнего угла
+type Signing struct {
+	Enabled  bool      `mapstructure:"enabled"`
+	CertFile string    `mapstructure:"cert_file"`
+	KeyFile  string    `mapstructure:"key_file"`
+	Visible  bool      `mapstructure:"visible"`
+	Rect     []float64 `mapstructure:"rect"`
 }
 
 func LoadConfig(configPath string) (*Config, error) {
@@ -35,6 +122,33 @@ func LoadConfig(configPath string) (*Config, error) {
 
 	viper.AutomaticEnv() // Чтение переменных окружения
 
+	viper.SetDefault("s3.url_expiry", "24h")
+	viper.SetDefault("storage.backend", "s3")
+	viper.SetDefault("storage.retry_attempts", 4)
+	viper.SetDefault("storage.retry_base_delay", "200ms")
+	viper.SetDefault("storage.retry_max_delay", "5s")
+	viper.SetDefault("storage.attempt_timeout", "30s")
+	viper.SetDefault("storage.breaker_failures", 5)
+	viper.SetDefault("storage.breaker_cooldown", "30s")
+	viper.SetDefault("jobs.ttl", "1h")
+	viper.SetDefault("jobs.cleanup_interval", "5m")
+	viper.SetDefault("jobs.timeout", "10m")
+	viper.SetDefault("logos.fetch", true)
+	viper.SetDefault("logos.fetch_timeout", "10s")
+	viper.SetDefault("logos.hosts", []string{"pics.avs.io"})
+	viper.SetDefault("logos.cache_dir", "cache/logos")
+	viper.SetDefault("logos.fallback_dir", "assets/logos")
+	viper.SetDefault("protection.enabled", false)
+	viper.SetDefault("protection.allow_print", true)
+	viper.SetDefault("protection.booking_password", false)
+	viper.SetDefault("pdfa.enabled", false)
+	viper.SetDefault("outbox.enabled", false)
+	viper.SetDefault("outbox.dir", "outbox")
+	viper.SetDefault("outbox.interval", "30s")
+	viper.SetDefault("signing.enabled", false)
+	viper.SetDefault("signing.visible", false)
+	viper.SetDefault("signing.rect", []float64{135, 277, 65, 12})
+
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
 			return nil, fmt.Errorf("config file not found: %w", err)
@@ -0,0 +1,302 @@
+// Package outbox - локальный спул документов, которые не удалось загрузить в хранилище. Документ и его
+// описание пишутся на диск атомарно и переживают перезапуск, фоновая выгрузка отправляет их в хранилище,
+// когда оно снова доступно
+package outbox
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"pdf-microservice/internal/save"
+	"pdf-microservice/internal/save/retry"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dataExt = ".pdf"
+	metaExt = ".json"
+	tmpExt  = ".tmp"
+)
+
+// Item - описание документа в спуле, лежит рядом с ним в {id}.json
+type Item struct {
+	ID          string     `json:"id"`
+	Key         string     `json:"key"`
+	ContentType string     `json:"content_type"`
+	Size        int        `json:"size"`
+	CreatedAt   time.Time  `json:"created_at"`
+	Attempts    int        `json:"attempts"`
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+}
+
+// Stats - состояние спула
+type Stats struct {
+	Depth int   `json:"depth"`
+	Bytes int64 `json:"bytes"`
+	// OldestCreatedAt и OldestAgeSeconds - самый старый документ, ждущий выгрузки
+	OldestCreatedAt  *time.Time `json:"oldest_created_at,omitempty"`
+	OldestAgeSeconds float64    `json:"oldest_age_seconds"`
+	LastError        string     `json:"last_error,omitempty"`
+}
+
+// Outbox хранит документы в каталоге dir и выгружает их в storage
+type Outbox struct {
+	dir     string
+	storage save.Storage
+	// drain не даёт двум выгрузкам отправлять одни и те же документы
+	drain sync.Mutex
+}
+
+// NewOutbox открывает спул в каталоге dir. Недописанные при прошлом запуске файлы удаляются
+func NewOutbox(dir string, storage save.Storage) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory %s: %w", dir, err)
+	}
+	o := &Outbox{dir: dir, storage: storage}
+	if err := o.removeIncomplete(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Add кладёт документ в спул. После возврата без ошибки документ на диске и будет выгружен
+func (o *Outbox) Add(key string, data []byte, contentType string) error {
+	id, err := newID()
+	if err != nil {
+		return fmt.Errorf("failed to generate outbox id: %w", err)
+	}
+
+	// Сначала документ, затем описание: описание без документа не появится, а документ без
+	// описания при следующем запуске считается недописанным
+	if err = writeFile(o.path(id, dataExt), data); err != nil {
+		return fmt.Errorf("failed to spool %s: %w", key, err)
+	}
+	item := Item{ID: id, Key: key, ContentType: contentType, Size: len(data), CreatedAt: time.Now().UTC()}
+	if err = o.writeItem(item); err != nil {
+		os.Remove(o.path(id, dataExt))
+		return fmt.Errorf("failed to spool %s: %w", key, err)
+	}
+	return nil
+}
+
+// Items возвращает описания документов в спуле от старых к новым
+func (o *Outbox) Items() ([]Item, error) {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox directory: %w", err)
+	}
+
+	var items []Item
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), metaExt) {
+			continue
+		}
+		item, err := o.readItem(filepath.Join(o.dir, entry.Name()))
+		if errors.Is(err, fs.ErrNotExist) {
+			// Документ выгрузили между чтением каталога и чтением описания
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	// Идентификаторы начинаются со времени добавления
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return items, nil
+}
+
+// Stats возвращает глубину спула и возраст самого старого документа
+func (o *Outbox) Stats() (Stats, error) {
+	items, err := o.Items()
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{Depth: len(items)}
+	var lastAttempt time.Time
+	for _, item := range items {
+		stats.Bytes += int64(item.Size)
+		if item.LastAttempt != nil && item.LastAttempt.After(lastAttempt) {
+			lastAttempt = *item.LastAttempt
+			stats.LastError = item.LastError
+		}
+	}
+	if len(items) > 0 {
+		oldest := items[0].CreatedAt
+		stats.OldestCreatedAt = &oldest
+		stats.OldestAgeSeconds = time.Since(oldest).Seconds()
+	}
+	return stats, nil
+}
+
+// Drain отправляет документы спула в хранилище от старых к новым и возвращает число выгруженных.
+// Документ, который не удалось загрузить, остаётся в спуле до следующей выгрузки, а если хранилище
+// недоступно (retry.ErrUnavailable, retry.ErrCircuitOpen), выгрузка останавливается до следующего раза
+func (o *Outbox) Drain(ctx context.Context) (int, error) {
+	o.drain.Lock()
+	defer o.drain.Unlock()
+
+	items, err := o.Items()
+	if err != nil {
+		return 0, err
+	}
+
+	uploaded := 0
+	for _, item := range items {
+		if ctx.Err() != nil {
+			return uploaded, ctx.Err()
+		}
+
+		data, err := os.ReadFile(o.path(item.ID, dataExt))
+		if err != nil {
+			return uploaded, fmt.Errorf("failed to read spooled %s: %w", item.Key, err)
+		}
+
+		err = o.storage.Put(ctx, item.Key, data, item.ContentType)
+		if err != nil {
+			now := time.Now().UTC()
+			item.Attempts++
+			item.LastAttempt = &now
+			item.LastError = err.Error()
+			if err := o.writeItem(item); err != nil {
+				log.Printf("Failed to update outbox item %s: %v", item.ID, err)
+			}
+			// Хранилище недоступно - остальные документы тоже не загрузятся, ждём следующей выгрузки.
+			// Ошибка одного документа не мешает загрузить следующие
+			if errors.Is(err, retry.ErrCircuitOpen) || errors.Is(err, retry.ErrUnavailable) || ctx.Err() != nil {
+				return uploaded, nil
+			}
+			continue
+		}
+
+		// Описание удаляется первым: без него документ больше не считается ждущим выгрузки
+		if err = os.Remove(o.path(item.ID, metaExt)); err != nil {
+			return uploaded, fmt.Errorf("failed to remove uploaded %s from outbox: %w", item.Key, err)
+		}
+		os.Remove(o.path(item.ID, dataExt))
+		uploaded++
+	}
+	return uploaded, nil
+}
+
+// Run выгружает спул каждые interval до отмены контекста
+func (o *Outbox) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			uploaded, err := o.Drain(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Failed to drain outbox: %v", err)
+			}
+			if uploaded > 0 {
+				log.Printf("Uploaded %d documents from outbox", uploaded)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// removeIncomplete удаляет временные файлы и документы без описания, оставшиеся после сбоя
+func (o *Outbox) removeIncomplete() error {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read outbox directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		incomplete := strings.HasSuffix(name, tmpExt)
+		if id, ok := strings.CutSuffix(name, dataExt); ok {
+			_, err := os.Stat(o.path(id, metaExt))
+			incomplete = errors.Is(err, fs.ErrNotExist)
+		}
+		if incomplete {
+			log.Printf("Removing incomplete outbox file %s", name)
+			if err := os.Remove(filepath.Join(o.dir, name)); err != nil {
+				return fmt.Errorf("failed to remove incomplete outbox file: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (o *Outbox) writeItem(item Item) error {
+	meta, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(o.path(item.ID, metaExt), meta)
+}
+
+func (o *Outbox) readItem(path string) (Item, error) {
+	meta, err := os.ReadFile(path)
+	if err != nil {
+		return Item{}, err
+	}
+	var item Item
+	if err = json.Unmarshal(meta, &item); err != nil {
+		return Item{}, fmt.Errorf("failed to parse outbox item %s: %w", filepath.Base(path), err)
+	}
+	return item, nil
+}
+
+func (o *Outbox) path(id, ext string) string {
+	return filepath.Join(o.dir, id+ext)
+}
+
+// writeFile пишет файл атомарно: во временный файл с fsync, затем переименование
+func writeFile(path string, data []byte) error {
+	tmp := path + tmpExt
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// fsync каталога фиксирует само переименование
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// newID - время добавления в наносекундах и случайный суффикс, чтобы идентификаторы сортировались по времени
+func newID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%020d-%s", time.Now().UnixNano(), hex.EncodeToString(b)), nil
+}
@@ -0,0 +1,63 @@
+package pdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"pdf-microservice/internal/models"
+	"pdf-microservice/internal/pdfa"
+	"strings"
+	"time"
+)
+
+// archiveAttachment - имя вложения с данными бронирования в документах PDF/A
+const archiveAttachment = "booking.json"
+
+// archiveEnabled сообщает, нужен ли бронированию PDF/A: запрос переопределяет конфиг. Документы под паролем
+// остаются обычными PDF - шифрование в PDF/A запрещено
+func (r *Renderer) archiveEnabled(booking models.RequestData) bool {
+	archived := r.Archived(booking)
+	if !archived && r.requestedPDFA(booking) {
+		log.Printf("Skipping PDF/A for encrypted documents of booking %d", booking.Ticket.ID)
+	}
+	return archived
+}
+
+// Archived сообщает, будут ли документы бронирования выпущены в PDF/A
+func (r *Renderer) Archived(booking models.RequestData) bool {
+	_, protected := r.options.Protection.userPassword(booking)
+	return r.requestedPDFA(booking) && !protected
+}
+
+func (r *Renderer) requestedPDFA(booking models.RequestData) bool {
+	if booking.PDFA != nil {
+		return *booking.PDFA
+	}
+	return r.options.PDFA
+}
+
+// archive выводит документ и, если нужно, переводит его в PDF/A-3b, вкладывая embedded в booking.json.
+// passengerName попадает в заголовок документа, пусто для общего документа бронирования
+func (r *Renderer) archive(c *canvas, booking models.RequestData, embedded models.RequestData, passengerName string) ([]byte, error) {
+	data, err := c.output()
+	if err != nil || !r.archiveEnabled(booking) {
+		return data, err
+	}
+
+	content, err := json.MarshalIndent(embedded, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode booking data: %w", err)
+	}
+
+	title := strings.TrimSpace(fmt.Sprintf("%s %d %s", booking.Document(), booking.Ticket.ID, passengerName))
+	data, err = pdfa.Convert(data, pdfa.Metadata{Title: title, CreatedAt: time.Now()}, pdfa.Attachment{
+		Name:        archiveAttachment,
+		Description: fmt.Sprintf("Booking %d request data", booking.Ticket.ID),
+		MIME:        "application/json",
+		Content:     content,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert to PDF/A: %w", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,125 @@
+package pdf
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// fontRunes возвращает символы, для которых в шрифте TrueType есть глифы. Нужен, чтобы не выводить
+// знаки валют, которых нет в шрифте: fpdf молча рисует вместо них пустое место
+func fontRunes(font []byte) (map[rune]bool, error) {
+	cmap, err := fontTable(font, "cmap")
+	if err != nil {
+		return nil, err
+	}
+	if len(cmap) < 4 {
+		return nil, errors.New("cmap table is too short")
+	}
+
+	// Предпочтительна полная таблица Unicode (формат 12), иначе - таблица для BMP (формат 4)
+	var subtable []byte
+	for i, n := 0, int(binary.BigEndian.Uint16(cmap[2:])); i < n; i++ {
+		record := 4 + i*8
+		if record+8 > len(cmap) {
+			break
+		}
+		platform, encoding := binary.BigEndian.Uint16(cmap[record:]), binary.BigEndian.Uint16(cmap[record+2:])
+		offset := int(binary.BigEndian.Uint32(cmap[record+4:]))
+		if offset+2 > len(cmap) {
+			continue
+		}
+		format := binary.BigEndian.Uint16(cmap[offset:])
+		unicode := platform == 0 || (platform == 3 && (encoding == 1 || encoding == 10))
+		if unicode && (format == 12 || (format == 4 && subtable == nil)) {
+			subtable = cmap[offset:]
+		}
+	}
+	if subtable == nil {
+		return nil, errors.New("no unicode cmap subtable")
+	}
+
+	if binary.BigEndian.Uint16(subtable) == 12 {
+		return cmapFormat12(subtable)
+	}
+	return cmapFormat4(subtable)
+}
+
+func fontTable(font []byte, tag string) ([]byte, error) {
+	if len(font) < 12 {
+		return nil, errors.New("font is too short")
+	}
+	for i, n := 0, int(binary.BigEndian.Uint16(font[4:])); i < n; i++ {
+		record := 12 + i*16
+		if record+16 > len(font) {
+			break
+		}
+		if string(font[record:record+4]) != tag {
+			continue
+		}
+		offset, length := binary.BigEndian.Uint32(font[record+8:]), binary.BigEndian.Uint32(font[record+12:])
+		if uint64(offset)+uint64(length) > uint64(len(font)) {
+			return nil, fmt.Errorf("%s table is out of bounds", tag)
+		}
+		return font[offset : offset+length], nil
+	}
+	return nil, fmt.Errorf("no %s table", tag)
+}
+
+func cmapFormat4(table []byte) (map[rune]bool, error) {
+	if len(table) < 14 {
+		return nil, errors.New("cmap format 4 is too short")
+	}
+	segments := int(binary.BigEndian.Uint16(table[6:])) / 2
+	ends, starts, deltas, rangeOffsets := 14, 16+segments*2, 16+segments*4, 16+segments*6
+	if rangeOffsets+segments*2 > len(table) {
+		return nil, errors.New("cmap format 4 is out of bounds")
+	}
+
+	runes := make(map[rune]bool)
+	for i := 0; i < segments; i++ {
+		end := int(binary.BigEndian.Uint16(table[ends+i*2:]))
+		start := int(binary.BigEndian.Uint16(table[starts+i*2:]))
+		delta := int(binary.BigEndian.Uint16(table[deltas+i*2:]))
+		rangeOffset := int(binary.BigEndian.Uint16(table[rangeOffsets+i*2:]))
+		for code := start; code <= end && code != 0xFFFF; code++ {
+			glyph := (code + delta) & 0xFFFF
+			if rangeOffset != 0 {
+				at := rangeOffsets + i*2 + rangeOffset + (code-start)*2
+				if at+2 > len(table) {
+					break
+				}
+				if glyph = int(binary.BigEndian.Uint16(table[at:])); glyph != 0 {
+					glyph = (glyph + delta) & 0xFFFF
+				}
+			}
+			if glyph != 0 {
+				runes[rune(code)] = true
+			}
+		}
+	}
+	return runes, nil
+}
+
+func cmapFormat12(table []byte) (map[rune]bool, error) {
+	if len(table) < 16 {
+		return nil, errors.New("cmap format 12 is too short")
+	}
+	groups := int(binary.BigEndian.Uint32(table[12:]))
+	if 16+groups*12 > len(table) {
+		return nil, errors.New("cmap format 12 is out of bounds")
+	}
+
+	runes := make(map[rune]bool)
+	for i := 0; i < groups; i++ {
+		group := table[16+i*12:]
+		start, end := binary.BigEndian.Uint32(group), binary.BigEndian.Uint32(group[4:])
+		startGlyph := binary.BigEndian.Uint32(group[8:])
+		for code := start; code <= end && code <= 0x10FFFF; code++ {
+			if startGlyph+(code-start) != 0 {
+				runes[rune(code)] = true
+			}
+		}
+	}
+	return runes, nil
+}
@@ -0,0 +1,336 @@
+package pdf
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"pdf-microservice/internal/i18n"
+	"pdf-microservice/internal/money"
+	"pdf-microservice/internal/qrcodes"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	elementText       = "text"
+	elementMultiCell  = "multicell"
+	elementLine       = "line"
+	elementRect       = "rect"
+	elementPolygon    = "polygon"
+	elementDashedLine = "dashed_line"
+	elementQRCode     = "qrcode"
+	elementPDF417     = "pdf417"
+	// elementCarrierLogo - логотип перевозчика текущего сегмента, вписывается в w x h с сохранением пропорций
+	elementCarrierLogo = "carrier_logo"
+)
+
+const (
+	repeatNone     = ""
+	repeatSegments = "segments"
+)
+
+// Layout - декларативное описание билета. Координаты секций задаются относительно
+// её начала, секции выводятся сверху вниз в порядке описания
+type Layout struct {
+	Page     Page              `json:"page"`
+	Fonts    []Font            `json:"fonts"`
+	Colors   map[string]RGB    `json:"colors"`
+	Sections []Section         `json:"sections"`
+	Cover    []Section         `json:"cover"` // обложка общего документа бронирования, выводится перед документами пассажиров
+	fonts    map[string][]byte `json:"-"`
+	// images - картинки элементов (логотипы в QR-кодах) по путям к файлам
+	images map[string][]byte
+	// runes - символы, которые есть во всех шрифтах макета
+	runes map[rune]bool
+}
+
+type Page struct {
+	Orientation string  `json:"orientation"`
+	Size        string  `json:"size"`
+	Top         float64 `json:"top"` // Y первой секции на новой странице
+}
+
+type Font struct {
+	Name string `json:"name"`
+	File string `json:"file"`
+}
+
+type RGB [3]int
+
+type Section struct {
+	Name string `json:"name"`
+	// Repeat - по чему повторяется секция: пусто (один раз) или segments (для каждого сегмента перелёта).
+	// Идущие подряд секции segments выводятся вместе для каждого сегмента
+	Repeat string `json:"repeat"`
+	// Reserve - сколько места нужно секции, если до конца страницы меньше, секция переносится на новую
+	Reserve float64 `json:"reserve"`
+	// NewPage - каждый вывод секции начинается с новой страницы (кроме самого первого)
+	NewPage bool `json:"new_page"`
+	// Height - на сколько сдвигается курсор после вывода секции
+	Height float64 `json:"height"`
+	// When - шаблон условия, секция выводится, только если он дал непустую строку
+	When     string    `json:"when"`
+	Elements []Element `json:"elements"`
+
+	whenTmpls map[string]*template.Template
+}
+
+type Element struct {
+	Type string  `json:"type"`
+	X    float64 `json:"x"`
+	Y    float64 `json:"y"`
+	X2   float64 `json:"x2"`
+	Y2   float64 `json:"y2"`
+	W    float64 `json:"w"`
+	H    float64 `json:"h"`
+	// After - если задано, текст выводится вслед за предыдущим текстом с указанным отступом, X игнорируется
+	After    *float64     `json:"after"`
+	Points   [][2]float64 `json:"points"`
+	Font     string       `json:"font"`
+	Size     float64      `json:"size"`
+	Color    string       `json:"color"`
+	Fill     string       `json:"fill"`
+	Style    string       `json:"style"`
+	Align    string       `json:"align"`
+	RectSize float64      `json:"rect_size"`
+	Space    float64      `json:"space"`
+	// Level - уровень коррекции ошибок QR-кода: L, M, Q, H; по умолчанию M, с логотипом - H
+	Level string `json:"level"`
+	// QuietZone - светлая рамка QR-кода в модулях, по умолчанию 4. Color - цвет модулей, Fill - фон
+	QuietZone *int `json:"quiet_zone"`
+	// Logo - PNG или JPEG в центре QR-кода, LogoSize - его доля от ширины кода (по умолчанию 0.2, не больше 0.3)
+	Logo     string  `json:"logo"`
+	LogoSize float64 `json:"logo_size"`
+	// Text - шаблон text/template, для qrcode и pdf417 - кодируемые данные
+	// (строка посадочного талона IATA BCBP для текущего сегмента - {{.BCBP}})
+	Text string `json:"text"`
+
+	// Шаблоны компилируются отдельно для каждого языка, чтобы функции t, date и upper знали локаль
+	tmpls map[string]*template.Template
+}
+
+func (l *Layout) templateFuncs(catalog *i18n.Catalog) template.FuncMap {
+	return template.FuncMap{
+		"money": func(amount money.Amount) string {
+			return catalog.FormatMoney(amount, l.currencySymbol(amount.Currency))
+		},
+		"t":        catalog.T,
+		"upper":    catalog.Upper,
+		"date":     catalog.FormatDate,
+		"dayShift": catalog.DayShift,
+		"duration": catalog.Duration,
+		"meal":     catalog.Meal,
+		"baggage":  catalog.Baggage,
+		"minusMinutes": func(minutes int, t time.Time) time.Time {
+			return t.Add(-time.Duration(minutes) * time.Minute)
+		},
+	}
+}
+
+// LoadLayout читает макет из файла
+func LoadLayout(path string) (*Layout, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout %s: %w", path, err)
+	}
+
+	return ParseLayout(data)
+}
+
+// ParseLayout разбирает макет, компилирует шаблоны и загружает шрифты, чтобы ошибки всплывали при старте
+func ParseLayout(data []byte) (*Layout, error) {
+	var layout Layout
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return nil, fmt.Errorf("failed to parse layout: %w", err)
+	}
+
+	layout.fonts = make(map[string][]byte, len(layout.Fonts))
+	for _, font := range layout.Fonts {
+		fontBytes, err := os.ReadFile(font.File)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load font %s: %w", font.Name, err)
+		}
+		layout.fonts[font.Name] = fontBytes
+
+		runes, err := fontRunes(fontBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read glyphs of font %s: %w", font.Name, err)
+		}
+		if layout.runes == nil {
+			layout.runes = runes
+		}
+		for r := range layout.runes {
+			if !runes[r] {
+				delete(layout.runes, r)
+			}
+		}
+	}
+
+	for i := range layout.Sections {
+		if err := layout.compileSection(&layout.Sections[i]); err != nil {
+			return nil, err
+		}
+	}
+	for i := range layout.Cover {
+		if err := layout.compileSection(&layout.Cover[i]); err != nil {
+			return nil, fmt.Errorf("cover: %w", err)
+		}
+	}
+
+	return &layout, nil
+}
+
+func (l *Layout) compileSection(section *Section) error {
+	switch section.Repeat {
+	case repeatNone, repeatSegments:
+	default:
+		return fmt.Errorf("section %q: unknown repeat %q", section.Name, section.Repeat)
+	}
+
+	if section.When != "" {
+		tmpls, err := l.compileTemplate("when", section.When)
+		if err != nil {
+			return fmt.Errorf("section %q: invalid when template: %w", section.Name, err)
+		}
+		section.whenTmpls = tmpls
+	}
+
+	for j := range section.Elements {
+		element := &section.Elements[j]
+		if err := l.compile(element); err != nil {
+			return fmt.Errorf("section %q, element %d: %w", section.Name, j, err)
+		}
+	}
+
+	return nil
+}
+
+func (l *Layout) compile(element *Element) error {
+	switch element.Type {
+	case elementText, elementMultiCell, elementQRCode, elementPDF417:
+		tmpls, err := l.compileTemplate(element.Type, element.Text)
+		if err != nil {
+			return fmt.Errorf("invalid text template: %w", err)
+		}
+		element.tmpls = tmpls
+	case elementLine, elementRect, elementPolygon, elementDashedLine, elementCarrierLogo:
+	default:
+		return fmt.Errorf("unknown element type %q", element.Type)
+	}
+
+	if element.Type == elementQRCode {
+		if err := l.compileQRCode(element); err != nil {
+			return err
+		}
+	}
+
+	if element.Font != "" {
+		if _, ok := l.fonts[element.Font]; !ok {
+			return fmt.Errorf("unknown font %q", element.Font)
+		}
+	}
+	for _, name := range []string{element.Color, element.Fill} {
+		if _, ok := l.Colors[name]; name != "" && !ok {
+			return fmt.Errorf("unknown color %q", name)
+		}
+	}
+
+	return nil
+}
+
+// compileQRCode подставляет значения по умолчанию и загружает логотип QR-кода
+func (l *Layout) compileQRCode(element *Element) error {
+	// Уровень в макете можно писать в любом регистре, как и в qrcodes.Encode
+	element.Level = strings.ToUpper(element.Level)
+	if element.QuietZone == nil {
+		quietZone := 4
+		element.QuietZone = &quietZone
+	}
+	if *element.QuietZone < 0 {
+		return fmt.Errorf("quiet_zone must not be negative")
+	}
+
+	if element.Logo == "" {
+		if element.Level == "" {
+			element.Level = "M"
+		}
+		_, ok := qrcodes.Levels[element.Level]
+		if !ok {
+			return fmt.Errorf("unknown qr level %q, expected L, M, Q or H", element.Level)
+		}
+		return nil
+	}
+
+	// Логотип закрывает часть модулей, восстановить их позволяют только уровни Q и H
+	switch element.Level {
+	case "":
+		element.Level = "H"
+	case "Q", "H":
+	default:
+		return fmt.Errorf("qr level %q is too low for a logo, use Q or H", element.Level)
+	}
+	if element.LogoSize == 0 {
+		element.LogoSize = 0.2
+	}
+	if element.LogoSize < 0 || element.LogoSize > 0.3 {
+		return fmt.Errorf("logo_size must be between 0 and 0.3")
+	}
+	if imageType(element.Logo) == "" {
+		return fmt.Errorf("logo %s must be a PNG or JPEG", element.Logo)
+	}
+	if _, ok := l.images[element.Logo]; !ok {
+		data, err := os.ReadFile(element.Logo)
+		if err != nil {
+			return fmt.Errorf("failed to load logo: %w", err)
+		}
+		if l.images == nil {
+			l.images = make(map[string][]byte)
+		}
+		l.images[element.Logo] = data
+	}
+	return nil
+}
+
+// imageType возвращает тип картинки для fpdf по расширению файла, пусто - тип не поддерживается
+func imageType(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".png":
+		return "png"
+	case ".jpg", ".jpeg":
+		return "jpg"
+	}
+	return ""
+}
+
+// compileTemplate компилирует шаблон для каждого языка
+func (l *Layout) compileTemplate(name, text string) (map[string]*template.Template, error) {
+	tmpls := make(map[string]*template.Template)
+	for _, locale := range i18n.Locales() {
+		tmpl, err := template.New(name).Funcs(l.templateFuncs(i18n.Get(locale))).Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		tmpls[locale] = tmpl
+	}
+	return tmpls, nil
+}
+
+// currencySymbol возвращает знак валюты, а если его нет в шрифтах макета (₽, ₺ в Roboto) - код ISO 4217
+func (l *Layout) currencySymbol(code string) string {
+	currency, _ := money.Lookup(code)
+	for _, r := range currency.Symbol {
+		if !l.runes[r] {
+			return currency.Code
+		}
+	}
+	return currency.Symbol
+}
+
+func (l *Layout) color(name string) RGB {
+	if name == "" {
+		return RGB{0, 0, 0}
+	}
+	return l.Colors[name]
+}
@@ -3,480 +3,679 @@ package pdf
 import (
 	"bytes"
 	"fmt"
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/pdf417"
 	"github.com/go-pdf/fpdf"
-	"image/color"
 	"log"
 	"math"
+	"pdf-microservice/internal/airports"
+	"pdf-microservice/internal/bcbp"
+	"pdf-microservice/internal/i18n"
+	"pdf-microservice/internal/itinerary"
+	"pdf-microservice/internal/logos"
 	"pdf-microservice/internal/models"
+	"pdf-microservice/internal/money"
 	"pdf-microservice/internal/qrcodes"
-	"strconv"
+	"pdf-microservice/internal/qrtoken"
+	"slices"
 	"strings"
+	"text/template"
 	"time"
 )
 
-const (
-	partialPayment         = "PARTIAL PAYMENT"
-	verifyFlights          = "Please verify flight times prior to departure"
-	departure              = "DEPARTURE: "
-	departingAt            = "Departing At:"
-	arrivingAt             = "Arriving At:"
-	aircraft               = "Aircraft:"
-	distance               = "Distance (in Miles):"
-	stops                  = "Stop(s):"
-	meals                  = "Meals:"
-	passengerName          = "Passenger Name:"
-	seats                  = "Seats:"
-	checkIn                = "Check-In Required"
-	booking                = "Booking:"
-	termsAndConditionsLOGO = "TERMS AND CONDITIONS\n\n"
-	confirmed              = "CONFIRMED"
-	notAvailable           = "Not Available"
-)
-
-func GeneratePDF(ticket models.Ticket, client models.Adult, url string) ([]byte, error) {
+// Logos - источник логотипов перевозчиков. Вызывается при отрисовке, поэтому не должен ждать сеть
+type Logos interface {
+	Logo(carrier, url string) (logos.Image, bool)
+}
 
-	pdf := fpdf.New("P", "mm", "A4", "")
-	pdf.AddPage()
+// Options - общие для всех макетов настройки рендера
+type Options struct {
+	// Logos - источник логотипов, может быть nil - тогда логотипы не выводятся
+	Logos Logos
+	// Protection - защита документов паролем по умолчанию
+	Protection Protection
+	// PDFA - выпускать документы в PDF/A-3b по умолчанию
+	PDFA bool
+	// Tokens - подписанные токены для QR-кода, nil - QR содержит ссылку на файл
+	Tokens *qrtoken.Issuer
+}
 
-	// Define colors
-	greyColor := color.RGBA{R: 240, G: 240, B: 240, A: 255}
-	darkGreyColor := color.RGBA{R: 150, G: 150, B: 150, A: 255}
+// Renderer рисует билеты по макету, загруженному при старте сервиса
+type Renderer struct {
+	layout  *Layout
+	options Options
+}
 
-	//Load fonts
-	pdf.AddUTF8Font("Roboto-Regular", "", "./assets/Roboto-Regular.ttf")
-	pdf.AddUTF8Font("Roboto-Bold", "", "./assets/Roboto-Bold.ttf")
+func NewRenderer(layout *Layout, options Options) *Renderer {
+	return &Renderer{layout: layout, options: options}
+}
 
-	// Set initial X
-	currentX := 10.0
+// ticketData - данные, доступные в шаблонах макета
+type ticketData struct {
+	Locale        string
+	Ticket        models.Ticket
+	User          models.User
+	Passengers    []models.Passenger // все пассажиры бронирования, на обложке Passenger пустой
+	Passenger     models.Passenger
+	PassengerName string
+	URL           string
+	// VerifyURL - ссылка на проверку документа с подписанным токеном, пусто - токены не настроены
+	VerifyURL     string
+	IssuedAt      time.Time
+	DepartureDate time.Time
+	ReturnDate    time.Time
+	Fare          fareData
+	Itinerary     itineraryData
+	Segment       segmentData
+}
 
-	// Set initial Y
-	currentY := 7.0
+// fareData - стоимость бронирования в минимальных единицах валюты, для вывода через {{money}}
+type fareData struct {
+	Base  money.Amount
+	Taxes []fareLine
+	Fees  []fareLine
+	Total money.Amount
+	// Share - доля пассажира документа: итог, поделённый поровну между всеми пассажирами
+	Share      money.Amount
+	Passengers int
+	// Paid и Due - внесённая и оставшаяся сумма при частичной оплате
+	Paid money.Amount
+	Due  money.Amount
+	// Breakdown - передана разбивка стоимости
+	Breakdown bool
+}
 
-	// Header text
-	pdf.SetFont("Roboto-Bold", "", 13)
-	pdf.SetTextColor(0, 0, 0)
+type fareLine struct {
+	Code   string
+	Name   string
+	Amount money.Amount
+}
 
-	flightThereDate, err := time.Parse(time.RFC3339, ticket.Itineraries[0].Segments[0].DepartureTime)
-	if err != nil {
-		flightThereDate, err = time.Parse("2006-01-02T15:04:05", ticket.Itineraries[0].Segments[0].DepartureTime)
-		if err != nil {
-			log.Println("Error parsing time with 2006-01-02T15:04:05", err)
+// newFareData разбирает стоимость, уже проверенную при валидации, поэтому ошибки разбора не возвращает
+func newFareData(booking models.RequestData, passenger models.Passenger) fareData {
+	ticket := booking.Ticket
+	data := fareData{}
+	data.Total, _ = money.Parse(ticket.Price, ticket.Currency)
+
+	if fare := ticket.Fare; fare != nil {
+		data.Breakdown = true
+		data.Base, _ = money.Parse(fare.BaseFare, ticket.Currency)
+		lines := func(items []models.FareItem) []fareLine {
+			parsed := make([]fareLine, 0, len(items))
+			for _, item := range items {
+				amount, _ := money.Parse(item.Amount, ticket.Currency)
+				parsed = append(parsed, fareLine{Code: item.Code, Name: item.Name, Amount: amount})
+			}
+			return parsed
 		}
+		data.Taxes = lines(fare.Taxes)
+		data.Fees = lines(fare.Fees)
 	}
 
-	itinerariesAmount := len(ticket.Itineraries)
-	segmentsAmount := len(ticket.Itineraries[itinerariesAmount-1].Segments)
+	if ticket.PaymentStatus == models.PaymentPartiallyPaid {
+		data.Paid, _ = money.Parse(ticket.AmountPaid, ticket.Currency)
+		data.Due = money.Amount{Minor: data.Total.Minor - data.Paid.Minor, Currency: data.Total.Currency}
+	}
 
-	var flightBackDate time.Time
-	flightBackDate, err = time.Parse(time.RFC3339, ticket.Itineraries[itinerariesAmount-1].Segments[segmentsAmount-1].ArrivalTime)
-	if err != nil {
-		flightBackDate, err = time.Parse("2006-01-02T15:04:05", ticket.Itineraries[itinerariesAmount-1].Segments[segmentsAmount-1].ArrivalTime)
-		if err != nil {
-			log.Println("Error parsing time with 2006-01-02T15:04:05", err)
+	data.Passengers = len(booking.User.Passengers())
+	if shares := data.Total.Split(data.Passengers); passenger.Index < len(shares) {
+		data.Share = shares[passenger.Index]
+	}
+
+	return data
+}
+
+// itineraryData - маршрут с общим временем в пути, рассчитанным по временам сегментов
+type itineraryData struct {
+	models.Itineraries
+	TotalDuration time.Duration
+}
+
+// segmentData - сегмент с временами вылета и прилёта в часовых поясах аэропортов
+type segmentData struct {
+	models.Segments
+	Departure time.Time
+	Arrival   time.Time
+	// DepartureZone и ArrivalZone - смещение от UTC ("UTC+3"), пусто, если аэропорта нет в таблице
+	DepartureZone string
+	ArrivalZone   string
+	// ArrivalDayShift - на сколько дней дата прилёта позже даты вылета
+	ArrivalDayShift int
+	// FlightDuration - время в полёте
+	FlightDuration time.Duration
+	// Miles - расстояние из запроса или по координатам аэропортов, 0 - неизвестно
+	Miles int
+	// Seat - место пассажира документа, пусто - не назначено
+	Seat string
+	// Layover - пересадка после сегмента, nil для последнего сегмента маршрута
+	Layover *itinerary.Layover
+	Last    bool
+}
+
+func newSegmentData(segment models.Segments) segmentData {
+	data := segmentData{Segments: segment}
+
+	var known bool
+	data.Departure, known = parseTime(segment.DepartureTime, segment.DepartureAirport)
+	if known {
+		data.DepartureZone = airports.UTCOffset(data.Departure)
+	}
+	data.Arrival, known = parseTime(segment.ArrivalTime, segment.ArrivalAirport)
+	if known {
+		data.ArrivalZone = airports.UTCOffset(data.Arrival)
+	}
+	data.ArrivalDayShift = airports.DayShift(data.Departure, data.Arrival)
+
+	data.Miles = segment.Distance
+	if data.Miles == 0 {
+		data.Miles, _ = airports.DistanceMiles(segment.DepartureAirport, segment.ArrivalAirport)
+	}
+
+	return data
+}
+
+// BCBP возвращает строку посадочного талона IATA BCBP для текущего сегмента
+func (d ticketData) BCBP() string {
+	carrier, number := d.Segment.Flight()
+	return bcbp.Encode(bcbp.Leg{
+		FirstName:    d.Passenger.FirstName,
+		LastName:     d.Passenger.LastName,
+		PNR:          bcbp.PNR(d.Ticket.ID),
+		From:         d.Segment.DepartureAirport,
+		To:           d.Segment.ArrivalAirport,
+		Carrier:      carrier,
+		FlightNumber: number,
+		Date:         d.Segment.Departure,
+		Compartment:  bcbp.Compartment(d.Ticket.FlightClass),
+		Seat:         d.Segment.Seat,
+	})
+}
+
+// canvas - состояние отрисовки одного документа
+type canvas struct {
+	pdf     *fpdf.Fpdf
+	layout  *Layout
+	logos   Logos
+	y       float64
+	textEnd float64 // X конца последнего выведенного текста, для элементов с after
+	images  int
+	drawn   bool
+	// outline - добавлять закладки сегментов, bookmarks - закладки, ждущие первой выведенной секции
+	outline   bool
+	bookmarks []bookmark
+}
+
+type bookmark struct {
+	title string
+	level int
+}
+
+func (r *Renderer) newTicketData(booking models.RequestData, passenger models.Passenger, url string) ticketData {
+	ticket := booking.Ticket
+	data := ticketData{
+		Locale:        i18n.Normalize(booking.Locale),
+		Ticket:        ticket,
+		User:          booking.User,
+		Passengers:    booking.User.Passengers(),
+		Passenger:     passenger,
+		PassengerName: strings.ToUpper(fmt.Sprint(passenger.FirstName + "/" + passenger.LastName)),
+		URL:           url,
+		IssuedAt:      time.Now(),
+		Fare:          newFareData(booking, passenger),
+	}
+
+	if len(ticket.Itineraries) > 0 {
+		first := ticket.Itineraries[0]
+		last := ticket.Itineraries[len(ticket.Itineraries)-1]
+		if len(first.Segments) > 0 {
+			data.DepartureDate = newSegmentData(first.Segments[0]).Departure
+		}
+		if len(last.Segments) > 0 {
+			data.ReturnDate = newSegmentData(last.Segments[len(last.Segments)-1]).Arrival
 		}
 	}
 
-	flightThereGeo := strings.ToUpper(fmt.Sprintf("%s, %s", ticket.StartCityName, ticket.StartCountryName))
-	flightBackGeo := strings.ToUpper(fmt.Sprintf("%s, %s", ticket.FinalCityName, ticket.FinalCountryName))
+	if r.options.Tokens != nil {
+		claims := qrtoken.Claims{
+			BookingID:    ticket.ID,
+			DocumentType: booking.Document(),
+			Route:        route(ticket),
+			IssuedAt:     data.IssuedAt,
+		}
+		if passenger.Type != "" {
+			claims.Passenger = data.PassengerName
+			claims.PassengerType = passenger.Type
+		}
+		if !data.DepartureDate.IsZero() {
+			claims.Departure = &data.DepartureDate
+		}
+		data.VerifyURL = r.options.Tokens.URL(claims)
+	}
 
-	headerGeo := fmt.Sprint(flightThereGeo + " - " + flightBackGeo)
+	return data
+}
 
-	headerText := fmt.Sprintf("%s    %s         %s", flightThereDate.Format("02-01-2006"), flightBackDate.Format("02-01-2006"), strings.ToUpper(headerGeo))
-	pdf.SetXY(10, currentY)
-	pdf.Cell(0, 6, headerText)
-	pdf.SetXY(65, currentY+0.3)
-	pdf.SetFont("Roboto-Regular", "", 10)
-	pdf.CellFormat(0, 6, "TRIP", "", 0, "L", false, 0, "")
-	currentY = 21
+// route перечисляет аэропорты маршрута через дефис, направления - через пробел: "VKO-IST-HAM HAM-VKO"
+func route(ticket models.Ticket) string {
+	var itineraries []string
+	for _, itinerary := range ticket.Itineraries {
+		var airports []string
+		for i, segment := range itinerary.Segments {
+			if i == 0 || segment.DepartureAirport != itinerary.Segments[i-1].ArrivalAirport {
+				airports = append(airports, segment.DepartureAirport)
+			}
+			airports = append(airports, segment.ArrivalAirport)
+		}
+		if len(airports) > 0 {
+			itineraries = append(itineraries, strings.Join(airports, "-"))
+		}
+	}
+	return strings.Join(itineraries, " ")
+}
 
-	// Triangle
-	pdf.SetFillColor(0, 0, 0)
-	pdf.Polygon([]fpdf.PointType{{X: 37, Y: 8}, {X: 39, Y: 9.5}, {X: 37, Y: 11}}, "F")
+func (r *Renderer) newCanvas(booking models.RequestData) (*canvas, error) {
+	pdf := fpdf.New(r.layout.Page.Orientation, "mm", r.layout.Page.Size, "")
+	for _, font := range r.layout.Fonts {
+		pdf.AddUTF8FontFromBytes(font.Name, "", r.layout.fonts[font.Name])
+	}
+	if err := r.options.Protection.apply(pdf, booking); err != nil {
+		return nil, err
+	}
+	return &canvas{pdf: pdf, layout: r.layout, logos: r.options.Logos}, nil
+}
 
-	// QR Code
-	qrCodeBytes, err := qrcodes.GenerateQRCode(url)
+func (r *Renderer) GeneratePDF(booking models.RequestData, passenger models.Passenger, url string) ([]byte, error) {
+	c, err := r.newCanvas(booking)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate qr code: %w", err)
+		return nil, err
 	}
-	rdr := bytes.NewReader(qrCodeBytes)
-	opt := fpdf.ImageOptions{ImageType: "png", ReadDpi: true}
+	c.pdf.AddPage()
 
-	pdf.RegisterImageOptionsReader("qr-code", opt, rdr)
+	data := r.newTicketData(booking, passenger, url)
+	if err := c.drawSections(r.layout.Sections, data); err != nil {
+		return nil, err
+	}
 
-	pdf.Image("qr-code", 168.5, 12, 35, 35, false, "", 0, "")
+	return r.archive(c, booking, booking.ForPassenger(passenger), data.PassengerName)
+}
 
-	// Header line
-	pdf.Line(10, 13, 200, 13)
+// GenerateBookingPDF рисует общий документ бронирования: обложку из секций cover макета, затем документы
+// всех пассажиров подряд, каждый с новой страницы. В оглавлении PDF - закладки по пассажирам и их сегментам.
+// Макет без sections (счёт) - документ только на бронирование, он целиком состоит из обложки
+func (r *Renderer) GenerateBookingPDF(booking models.RequestData, url string) ([]byte, error) {
+	c, err := r.newCanvas(booking)
+	if err != nil {
+		return nil, err
+	}
+	catalog := i18n.Get(booking.Locale)
 
-	// Prepared for
-	pdf.SetFont("Roboto-Regular", "", 11)
-	pdf.SetXY(10, currentY)
-	pdf.Cell(0, 4, "PREPARED FOR")
-	currentY = 25.5
+	// Закладки в UTF-16 пишутся, только если текущий шрифт - UTF-8
+	if len(r.layout.Fonts) > 0 {
+		c.pdf.SetFont(r.layout.Fonts[0].Name, "", 10)
+	}
 
-	pdf.SetXY(10, currentY)
-	clientName := strings.ToUpper(fmt.Sprint(client.FirstName + "/" + client.LastName))
-	pdf.Cell(0, 4, clientName)
-	currentY = 30
+	if len(r.layout.Cover) > 0 {
+		c.startDocument(catalog.T("booking_summary"))
+		if err := c.drawSections(r.layout.Cover, r.newTicketData(booking, models.Passenger{}, url)); err != nil {
+			return nil, fmt.Errorf("cover: %w", err)
+		}
+	}
 
-	// Reservation code
-	pdf.SetXY(10, currentY)
-	pdf.Cell(0, 4, fmt.Sprintf("RESERVATION CODE     %d", ticket.ID))
-	currentY = 34.5
+	// Закладки сегментов - только внутри документов пассажиров, на обложке они бы повторялись
+	c.outline = true
+	passengers := booking.User.Passengers()
+	if len(r.layout.Sections) == 0 {
+		passengers = nil
+	}
+	for _, passenger := range passengers {
+		data := r.newTicketData(booking, passenger, url)
+		c.startDocument(fmt.Sprintf("%s (%s)", data.PassengerName, catalog.T("passenger_"+passenger.Type)))
+		if err := c.drawSections(r.layout.Sections, data); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", passenger.FirstName, passenger.LastName, err)
+		}
+	}
 
-	// Partial payment
-	pdf.SetXY(10, currentY)
-	pdf.Cell(0, 4, partialPayment)
-	currentY = 39
+	embedded := booking
+	embedded.Protection = nil
+	return r.archive(c, booking, embedded, "")
+}
 
-	// Final price
-	pdf.SetXY(10, currentY)
-	pdf.Cell(0, 4, fmt.Sprintf("FINAL PRICE: %s (taxes included)", ticket.Price))
-	currentY = 51
+// startDocument начинает документ внутри общего PDF с новой страницы, как если бы он был отдельным файлом
+func (c *canvas) startDocument(title string) {
+	c.pdf.AddPage()
+	c.y = 0
+	c.drawn = false
+	c.bookmarks = append(c.bookmarks, bookmark{title: title, level: 0})
+}
 
-	// Flights ticket
-	for _, itinerary := range ticket.Itineraries {
-		for _, segment := range itinerary.Segments {
+func (c *canvas) output() ([]byte, error) {
+	var buf bytes.Buffer
+	err := c.pdf.Output(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write PDF to buffer: %w", err)
+	}
 
-			if currentY+70 > 297 {
-				pdf.AddPage()
-				currentX = 10
-				currentY = 7
-			}
+	return buf.Bytes(), nil
+}
 
-			// Parsing timestamps
-			flightThereDate, err = time.Parse(time.RFC3339, segment.DepartureTime)
-			if err != nil {
-				flightThereDate, err = time.Parse("2006-01-02T15:04:05", segment.DepartureTime)
-				if err != nil {
-					log.Println("Error parsing time with 2006-01-02T15:04:05:", err)
-				}
-			}
+func (c *canvas) drawSections(sections []Section, data ticketData) error {
+	ticket := data.Ticket
+	catalog := i18n.Get(data.Locale)
+
+	for len(sections) > 0 {
+		// Подряд идущие секции сегментов выводятся группой: сегмент, пересадка, следующий сегмент
+		group := 1
+		for group < len(sections) && sections[0].Repeat == repeatSegments && sections[group].Repeat == repeatSegments {
+			group++
+		}
 
-			flightBackDate, err = time.Parse(time.RFC3339, segment.ArrivalTime)
-			if err != nil {
-				flightThereDate, err = time.Parse("2006-01-02T15:04:05", segment.ArrivalTime)
+		if sections[0].Repeat == repeatSegments {
+			for _, itin := range ticket.Itineraries {
+				timing, err := itinerary.Compute(itin.Segments)
 				if err != nil {
-					log.Println("Error parsing time with 2006-01-02T15:04:05:", err)
+					log.Printf("Error computing durations for ticket %d: %v", ticket.ID, err)
+				}
+				data.Itinerary = itineraryData{Itineraries: itin, TotalDuration: timing.Total}
+
+				for i, segment := range itin.Segments {
+					data.Segment = newSegmentData(segment)
+					if data.Passenger.Type != models.PassengerInfant {
+						data.Segment.Seat = segment.SeatFor(data.Passenger.FirstName, data.Passenger.LastName)
+					}
+					data.Segment.Last = i == len(itin.Segments)-1
+					if i < len(timing.Flights) {
+						data.Segment.FlightDuration = timing.Flights[i]
+					}
+					if i < len(timing.Layovers) {
+						data.Segment.Layover = &timing.Layovers[i]
+					}
+					if c.outline {
+						carrier, number := segment.Flight()
+						c.bookmarks = append(c.bookmarks, bookmark{level: 1, title: fmt.Sprintf("%s - %s, %s%s, %s",
+							segment.DepartureAirport, segment.ArrivalAirport, carrier, number,
+							catalog.FormatDate("02 Jan 2006 15:04", data.Segment.Departure))})
+					}
+					for _, section := range sections[:group] {
+						if err := c.drawSection(section, data); err != nil {
+							return err
+						}
+					}
 				}
 			}
+		} else if err := c.drawSection(sections[0], data); err != nil {
+			return err
+		}
+
+		sections = sections[group:]
+	}
+
+	return nil
+}
 
-			// 2nd Line
-			pdf.Line(10, currentY, 200, currentY)
-
-			// DEPARTURE TEXT-LINE
-			depatureDate := fmt.Sprintf(strings.ToUpper(flightThereDate.Format("Monday 02 January 2006")))
-			pdf.SetTextColor(0, 0, 0)
-			pdf.SetXY(10, currentY)
-			pdf.SetFillColor(0, 0, 0)
-
-			currentY += 0.5 //51.5
-			pdf.Polygon([]fpdf.PointType{{X: 12, Y: currentY + 0.5}, {X: 14, Y: currentY + 2}, {X: 12, Y: currentY + 3.5}}, "F")
-
-			pdf.SetXY(14, currentY)
-			currentX = pdf.GetX()
-			pdf.SetFont("Roboto-Regular", "", 11)
-			pdf.Cell(0, 5, departure)
-			currentX += pdf.GetStringWidth(departure)
-
-			pdf.SetFont("Roboto-Bold", "", 11)
-			pdf.SetXY(currentX+1, currentY)
-			pdf.Cell(0, 5, depatureDate)
-			currentX += pdf.GetStringWidth(depatureDate)
-
-			pdf.SetFont("Roboto-Regular", "", 8)
-			pdf.SetTextColor(int(darkGreyColor.R), int(darkGreyColor.G), int(darkGreyColor.B))
-			pdf.SetXY(currentX+4, currentY)
-			pdf.Cell(0, 6, verifyFlights)
-			currentY += 4 //55.5
-
-			pdf.SetFont("Roboto-Regular", "", 11)
-			pdf.SetTextColor(0, 0, 0)
-
-			// Flight grey background
-			pdf.SetFillColor(int(greyColor.R), int(greyColor.G), int(greyColor.B))
-			pdf.Rect(10, currentY+1, 50, 40, "F")
-
-			// Table top-line
-			currentY += 1 //56.5
-			pdf.SetDrawColor(int(darkGreyColor.R), int(darkGreyColor.G), int(darkGreyColor.B))
-			pdf.Line(60.5, currentY, 200, currentY)
-
-			// Table bottom-line
-			pdf.Line(60.5, currentY+40, 200, currentY+40)
-
-			// Table left-line
-			pdf.Line(60.5, currentY, 60.5, currentY+40)
-
-			// Table right-line
-			pdf.Line(200, currentY, 200, currentY+40)
-
-			// Dotted lines
-			pdf.SetLineCapStyle("round")
-			rectSize := 0.1
-			spaceLen := 0.5
-			drawDashedRectLine(pdf, 158, currentY, 158, currentY+40, rectSize, spaceLen)
-			drawDashedRectLine(pdf, 60.5, currentY+21.5, 158, currentY+21.5, rectSize, spaceLen)
-			drawDashedRectLine(pdf, 105, currentY+21.5, 105, currentY+40, rectSize, spaceLen)
-
-			// FLIGHT
-			currentX = 11
-			currentY += 1 //57.5
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(30, 4, "FLIGHT")
-
-			// Flight number
-			pdf.SetFont("Roboto-Bold", "", 11)
-			currentY += 8.5 //66
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(30, 4, segment.Carrier)
-
-			// Airline
-			pdf.SetFont("Roboto-Regular", "", 8)
-			currentY += 8 //74
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(30, 4, fmt.Sprintf("Airline: %s", segment.CarrierName))
-			pdf.SetX(60)
-
-			// Class
-			currentY += 4 //78
-			pdf.SetXY(currentX, currentY)
-			flightClass := fmt.Sprintf("Class: %s", strings.ToUpper(ticket.FlightClass))
-			pdf.Cell(30, 4, flightClass)
-
-			// Status
-			currentY += 8 //86
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(30, 4, fmt.Sprintf("Status: %s", confirmed))
-			// ----------------------------------------------------------
-
-			// FLIGHT AIRPORTS CODES
-			// Start airport-code
-			pdf.SetFont("Roboto-Regular", "", 11)
-			currentX = 64
-			currentY -= 27.5 //58.5
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, segment.DepartureAirport)
-
-			// Finish airport-code
-			currentX = 110
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, segment.ArrivalAirport)
-
-			// Triangle
-			currentX = 108
-			pdf.SetFillColor(0, 0, 0)
-			pdf.SetXY(currentX, currentY)
-			pdf.Polygon([]fpdf.PointType{{X: currentX, Y: currentY}, {X: currentX + 2, Y: currentY + 1.5}, {X: currentX, Y: currentY + 3}}, "F")
-
-			// Start airport city and country
-			currentX = 64
-			currentY += 4.5 //62
-			pdf.SetFont("Roboto-Regular", "", 8)
-			pdf.SetXY(currentX, currentY)
-			flightThereGeo = strings.ToUpper(fmt.Sprintf("%s, %s", segment.DepartureCityName, segment.DepartureCountryName))
-			pdf.Cell(0, 4, flightThereGeo)
-
-			// Finish airport city and country
-			currentX = 110
-			pdf.SetXY(currentX, currentY)
-			flightBackGeo = strings.ToUpper(fmt.Sprintf("%s, %s", segment.ArrivalCityName, segment.ArrivalCountryName))
-			pdf.Cell(0, 4, flightBackGeo)
-
-			//Departing At
-			currentX = 64
-			currentY += 18 //80
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, departingAt)
-
-			// Departure date
-			currentX = 64
-			currentY += 3 //83
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, flightThereDate.Format("02 January 2006"))
-
-			// Departure time
-			pdf.SetFont("Roboto-Regular", "", 12)
-			currentX = 64
-			currentY += 4 //87
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, flightThereDate.Format("03:04"))
-
-			//Arriving at
-			pdf.SetFont("Roboto-Regular", "", 8)
-			currentX = 112
-			currentY -= 7 //80
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, arrivingAt)
-
-			// Arrival date
-			currentX = 112
-			currentY += 3 //83
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, flightBackDate.Format("03:04"))
-
-			// Arrival time
-			pdf.SetFont("Roboto-Regular", "", 12)
-			currentX = 112
-			currentY += 4 //87
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, flightBackDate.Format("03:04"))
-			//----------------------------------------------------------
-
-			// FLIGHT RIGHT DATA
-			// Aircraft
-			pdf.SetFont("Roboto-Regular", "", 8)
-			currentX = 160
-			currentY -= 29 //58
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, aircraft)
-
-			// Aircraft number
-			currentX = 160
-			currentY += 4 // 62
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, notAvailable)
-
-			// Distance
-			currentX = 160
-			currentY += 4 // 66
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, distance)
-
-			// Distance ticket
-			currentX = 160
-			currentY += 4 // 70
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, notAvailable)
-
-			// Stops
-			currentX = 160
-			currentY += 4 // 74
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, stops)
-
-			//Space ticket
-			currentX = 160
-			currentY += 5 // 79
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, strconv.Itoa(itinerary.Stops))
-
-			// Meals
-			currentX = 160
-			currentY += 4 // 83
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, meals)
-
-			// Meals ticket
-			currentX = 160
-			currentY += 4 //87
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 4, notAvailable)
-			//---------------------------------------------
-
-			// BOTTOM TABLE
-			// Grey background
-			pdf.SetFillColor(int(greyColor.R), int(greyColor.G), int(greyColor.B))
-			pdf.Rect(10, currentY+12.5, 190, 4, "F")
-
-			// Dotted lines
-			drawDashedRectLine(pdf, 99, currentY+13, 99, currentY+20, rectSize, spaceLen)
-			drawDashedRectLine(pdf, 154, currentY+13, 154, currentY+20, rectSize, spaceLen)
-
-			// Passenger name
-			currentX = 10
-			currentY += 12 //100
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 5, passengerName)
-
-			// Passenger ticket
-			currentX = 10
-			currentY += 4 // 104
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 5, clientName)
-
-			// Seats
-			currentX = 100
-			currentY -= 4 // 100
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 5, seats)
-
-			// Seats ticket
-			currentX = 100
-			currentY += 4 // 104
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 5, checkIn)
-
-			//	Booking
-			currentX = 155
-			currentY -= 4 // 100
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 5, booking)
-
-			//	Booking Data
-			currentX = 155
-			currentY += 4 // 104
-			pdf.SetXY(currentX, currentY)
-			pdf.Cell(0, 5, confirmed)
-
-			currentY += 16 // 120
+func (c *canvas) drawSection(section Section, data ticketData) error {
+	if section.whenTmpls != nil {
+		when, err := execute(section.whenTmpls, data)
+		if err != nil {
+			return fmt.Errorf("section %q: %w", section.Name, err)
+		}
+		if strings.TrimSpace(when) == "" {
+			return nil
 		}
 	}
-	//----------------------------------
-
-	pdf.Line(10, currentY+1, 200, currentY+1)
-
-	// Terms and conditions
-	currentX = 10.0
-	currentY += 5.0
-
-	if currentY+110 > 297 {
-		pdf.AddPage()
-		currentX = 10
-		currentY = 7
-	}
-
-	// Выводим заголовок жирным шрифтом
-	pdf.SetXY(currentX, currentY)
-	pdf.SetFont("Roboto-Bold", "", 11)
-	pdf.Cell(0, 5, termsAndConditionsLOGO)
-
-	// Вывод многострочного текста, обернув в MultiCell
-	termsAndConditions := "If air carriage is provided for hereon, this document must be exchanged for a ticket and at such time prior to departure as may be required\n" +
-		"by the rules and regulations of the carrier to whom the document is directed\n\n" +
-		"If this document is issued in respect to baggage, the passenger must also have a passenger ticket and bag- baggage check, since this\n" +
-		"document is not the baggage check described by Article 4 of The Hague Protocol or The Warsaw Convention as amended by the Hague\n" +
-		"Protocol, 1955 or the Baggage Identification Tag described by Article 3 of the Montreal Convention 1999.\n\n" +
-		"This document and any carriage or services for which it provides are subject to the currently effective and applicable tariffs, conditions of\n" +
-		"carriage, rules and regulations of the issuer and of the carrier to whom it is directed and of any carrier performing carriage or services\n" +
-		"under the ticket or tickets issued in exchange for this order, and to all the terms and conditions under which non-air carriage services are\n" +
-		"arranged, offered or provided, as well as the laws of the country wherein these services are arranged, offered or provided.\n\n" +
-		"In issuing this document, the issuer acts only as agent for the carrier or carriers furnishing the carriage or the person arranging or\n" +
-		"supplying the services described hereon and the issuer shall not be liable for any loss, injury, damage or delay which is occasioned by\n" +
-		"such carrier or person, for which results from such carrier or person performing or failing to perform the carriage or other services, or from\n" +
-		"such carrier or person failing to honour this document.\n\n" +
-		"The honouring carrier or person providing services re- serves the right to obtain authorisation from the issuing carrier prior to honouring\n" +
-		"this document.\n\n" +
-		"The use of the term issuer, carrier or person includes all owners, subsidiaries and affiliates of such issuer, carrier or person and any\n" +
-		"person with whom such issuer, carrier or person has contracted to perform the carriage or services provided for hereon.\n\n" +
-		"The acceptance of this document by the person named on the face hereof, or by the person purchasing this document on behalf of such\n" +
-		"named person, shall be deemed to be consent to and acceptance by such person or persons of these conditions."
-
-	currentX = 10.0
-	currentY += 8.0 // Сдвигаем Y на высоту заголовка
-	pdf.SetXY(currentX, currentY)
-	// Выводим основной текст обычным шрифтом
-	pdf.SetFont("Roboto-Regular", "", 8)
-	// Выводим многострочный текст с использованием MultiCell, устанавливаем ширину 0, т.е. на всю строку
-	pdf.MultiCell(0, 3, termsAndConditions, "", "", false)
 
-	var buf bytes.Buffer
-	err = pdf.Output(&buf)
+	_, pageHeight := c.pdf.GetPageSize()
+	if (section.NewPage && c.drawn) || c.y+section.Reserve > pageHeight {
+		c.pdf.AddPage()
+		c.y = c.layout.Page.Top
+	}
+	c.drawn = true
+
+	for _, mark := range c.bookmarks {
+		c.pdf.Bookmark(mark.title, mark.level, c.y)
+	}
+	c.bookmarks = nil
+
+	for i, element := range section.Elements {
+		if err := c.drawElement(element, data); err != nil {
+			return fmt.Errorf("section %q, element %d: %w", section.Name, i, err)
+		}
+	}
+
+	// Секции без высоты (например, с многострочным текстом) продолжаются с того места, где остановился курсор
+	if section.Height == 0 {
+		c.y = c.pdf.GetY()
+	} else {
+		c.y += section.Height
+	}
+
+	return nil
+}
+
+func (c *canvas) drawElement(el Element, data ticketData) error {
+	pdf := c.pdf
+	y := c.y + el.Y
+
+	text, err := execute(el.tmpls, data)
 	if err != nil {
-		return nil, fmt.Errorf("failed to write PDF to buffer: %w", err)
+		return err
 	}
 
-	return buf.Bytes(), nil
+	color := c.layout.color(el.Color)
+	fill := c.layout.color(el.Fill)
+
+	switch el.Type {
+	case elementText:
+		pdf.SetFont(el.Font, "", el.Size)
+		pdf.SetTextColor(color[0], color[1], color[2])
+		x := el.X
+		if el.After != nil {
+			x = c.textEnd + *el.After
+		}
+		pdf.SetXY(x, y)
+		pdf.CellFormat(el.W, el.H, text, "", 0, el.Align, false, 0, "")
+		c.textEnd = x + pdf.GetStringWidth(text)
+
+	case elementMultiCell:
+		pdf.SetFont(el.Font, "", el.Size)
+		pdf.SetTextColor(color[0], color[1], color[2])
+		pdf.SetXY(el.X, y)
+		pdf.MultiCell(el.W, el.H, text, "", el.Align, false)
+
+	case elementLine:
+		pdf.SetDrawColor(color[0], color[1], color[2])
+		pdf.Line(el.X, y, el.X2, c.y+el.Y2)
+
+	case elementRect:
+		pdf.SetDrawColor(color[0], color[1], color[2])
+		pdf.SetFillColor(fill[0], fill[1], fill[2])
+		pdf.Rect(el.X, y, el.W, el.H, styleOrDefault(el.Style, "F"))
+
+	case elementPolygon:
+		pdf.SetDrawColor(color[0], color[1], color[2])
+		pdf.SetFillColor(fill[0], fill[1], fill[2])
+		points := make([]fpdf.PointType, len(el.Points))
+		for i, point := range el.Points {
+			points[i] = fpdf.PointType{X: point[0], Y: c.y + point[1]}
+		}
+		pdf.Polygon(points, styleOrDefault(el.Style, "F"))
+
+	case elementDashedLine:
+		pdf.SetDrawColor(color[0], color[1], color[2])
+		pdf.SetFillColor(color[0], color[1], color[2])
+		pdf.SetLineCapStyle("round")
+		drawDashedRectLine(pdf, el.X, y, el.X2, c.y+el.Y2, el.RectSize, el.Space)
+
+	case elementQRCode:
+		// Без ссылки (документ не сохраняется и токены не настроены) QR-код не рисуется
+		if text == "" {
+			break
+		}
+		if err := c.drawQRCode(el, y, text); err != nil {
+			return fmt.Errorf("failed to generate qr code: %w", err)
+		}
+
+	case elementPDF417:
+		code, err := pdf417.Encode(text, 2)
+		if err != nil {
+			return fmt.Errorf("failed to generate pdf417: %w", err)
+		}
+		pdf.SetFillColor(color[0], color[1], color[2])
+		drawBarcode(pdf, code, el.X, y, el.W, el.H)
+
+	case elementCarrierLogo:
+		c.drawCarrierLogo(el, y, data.Segment)
+	}
+
+	return pdf.Error()
+}
+
+// execute выполняет шаблон на языке документа, для элементов без шаблона возвращает пустую строку
+func execute(tmpls map[string]*template.Template, data ticketData) (string, error) {
+	tmpl := tmpls[data.Locale]
+	if tmpl == nil {
+		return "", nil
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// drawCarrierLogo вписывает логотип в прямоугольник элемента. Логотип - украшение,
+// поэтому если его нет или он битый, документ выводится без него
+func (c *canvas) drawCarrierLogo(el Element, y float64, segment segmentData) {
+	if c.logos == nil {
+		return
+	}
+	carrier, _ := segment.Flight()
+	logo, ok := c.logos.Logo(carrier, segment.CarrierLogo)
+	if !ok {
+		return
+	}
+
+	pdf := c.pdf
+	name := "logo-" + carrier + "-" + segment.CarrierLogo
+	info := pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: logo.Type}, bytes.NewReader(logo.Data))
+	if !pdf.Ok() {
+		log.Printf("Error drawing logo of %s: %v", carrier, pdf.Error())
+		pdf.ClearError()
+		return
+	}
+
+	scale := math.Min(el.W/info.Width(), el.H/info.Height())
+	w, h := info.Width()*scale, info.Height()*scale
+	x := el.X
+	switch el.Align {
+	case "R":
+		x += el.W - w
+	case "C":
+		x += (el.W - w) / 2
+	}
+	pdf.Image(name, x, y+(el.H-h)/2, w, h, false, "", 0, "")
+}
+
+func styleOrDefault(style, def string) string {
+	if style == "" {
+		return def
+	}
+	return style
+}
+
+func parseTime(value, airport string) (time.Time, bool) {
+	t, known, err := airports.ParseLocalTime(value, airport)
+	if err != nil {
+		log.Printf("Error parsing time %q for %s: %v", value, airport, err)
+	}
+	return t, known
+}
+
+// drawQRCode рисует QR-код векторными прямоугольниками в квадрате со стороной min(w, h):
+// фон, если задан fill, модули цветом color и логотип в центре на подложке цвета фона
+func (c *canvas) drawQRCode(el Element, y float64, text string) error {
+	modules, err := qrcodes.Encode(text, el.Level)
+	if err != nil {
+		return err
+	}
+
+	pdf := c.pdf
+	size := math.Min(el.W, el.H)
+	quietZone := float64(*el.QuietZone)
+	module := size / (float64(len(modules)) + 2*quietZone)
+	x0, y0 := el.X+quietZone*module, y+quietZone*module
+
+	background := RGB{255, 255, 255}
+	if el.Fill != "" {
+		background = c.layout.color(el.Fill)
+		pdf.SetFillColor(background[0], background[1], background[2])
+		pdf.Rect(el.X, y, size, size, "F")
+	}
+
+	color := c.layout.color(el.Color)
+	pdf.SetFillColor(color[0], color[1], color[2])
+	drawModules(pdf, modules, x0, y0, module, module)
+
+	if el.Logo == "" {
+		return nil
+	}
+	name := "qr-logo-" + el.Logo
+	info := pdf.RegisterImageOptionsReader(name, fpdf.ImageOptions{ImageType: imageType(el.Logo)}, bytes.NewReader(c.layout.images[el.Logo]))
+	if !pdf.Ok() {
+		return pdf.Error()
+	}
+
+	// Подложка выравнивается по сетке модулей и на модуль шире логотипа, чтобы логотип не касался модулей
+	content := float64(len(modules)) * module
+	pad := math.Ceil(content*el.LogoSize/module+2) * module
+	pdf.SetFillColor(background[0], background[1], background[2])
+	pdf.Rect(x0+(content-pad)/2, y0+(content-pad)/2, pad, pad, "F")
+
+	scale := math.Min(content*el.LogoSize/info.Width(), content*el.LogoSize/info.Height())
+	w, h := info.Width()*scale, info.Height()*scale
+	pdf.Image(name, x0+(content-w)/2, y0+(content-h)/2, w, h, false, "", 0, "")
+	return nil
+}
+
+// drawBarcode рисует штрихкод векторно, растягивая его на прямоугольник w x h.
+// Соседние тёмные модули строки и одинаковые строки объединяются в один прямоугольник
+func drawBarcode(pdf *fpdf.Fpdf, code barcode.Barcode, x, y, w, h float64) {
+	bounds := code.Bounds()
+	modules := make([][]bool, bounds.Dy())
+	for py := range modules {
+		modules[py] = make([]bool, bounds.Dx())
+		for px := range modules[py] {
+			r, _, _, _ := code.At(bounds.Min.X+px, bounds.Min.Y+py).RGBA()
+			modules[py][px] = r < 0x8000
+		}
+	}
+	drawModules(pdf, modules, x, y, w/float64(bounds.Dx()), h/float64(bounds.Dy()))
+}
+
+// drawModules закрашивает тёмные модули текущим цветом заливки, объединяя соседние модули строки
+// и одинаковые строки в один прямоугольник
+func drawModules(pdf *fpdf.Fpdf, modules [][]bool, x, y, moduleW, moduleH float64) {
+	for py := 0; py < len(modules); {
+		bits := modules[py]
+		rows := 1
+		for py+rows < len(modules) && slices.Equal(bits, modules[py+rows]) {
+			rows++
+		}
+
+		for px := 0; px < len(bits); {
+			if !bits[px] {
+				px++
+				continue
+			}
+			run := 1
+			for px+run < len(bits) && bits[px+run] {
+				run++
+			}
+			pdf.Rect(x+float64(px)*moduleW, y+float64(py)*moduleH, float64(run)*moduleW, float64(rows)*moduleH, "F")
+			px += run
+		}
+
+		py += rows
+	}
 }
 
 // drawDashedRectLine рисует пунктирную линию из квадратов
@@ -0,0 +1,70 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"github.com/go-pdf/fpdf"
+	"pdf-microservice/internal/models"
+)
+
+// Protection - шифрование документа паролем по умолчанию, запрос может его включить, выключить или задать свой пароль.
+// Редактирование и копирование текста запрещены всегда, печать - если разрешена AllowPrint.
+// Шифрование fpdf - RC4 40 бит, это обфускация от случайного просмотра, а не защита данных
+type Protection struct {
+	Enabled bool
+	// OwnerPassword - пароль владельца, снимающий ограничения; пусто - случайный для каждого документа
+	OwnerPassword string
+	AllowPrint    bool
+	// BookingPassword - если пароль не передан в запросе, паролем служит номер бронирования
+	BookingPassword bool
+}
+
+// ErrPasswordRequired - защита включена, но пароль на открытие не передан, а номер бронирования паролем не служит
+var ErrPasswordRequired = errors.New("protection requires an explicit password")
+
+// userPassword возвращает пароль на открытие документа бронирования, ok = false - документ не шифруется.
+// Без пароля в запросе и без BookingPassword пароль пустой
+func (p Protection) userPassword(booking models.RequestData) (password string, ok bool) {
+	enabled := p.Enabled
+	if requested := booking.Protection; requested != nil {
+		password = requested.Password
+		switch {
+		case requested.Enabled != nil:
+			enabled = *requested.Enabled
+		case password != "":
+			enabled = true
+		}
+	}
+	if enabled && password == "" && p.BookingPassword {
+		password = fmt.Sprint(booking.Ticket.ID)
+	}
+	return password, enabled
+}
+
+func (p Protection) apply(pdf *fpdf.Fpdf, booking models.RequestData) error {
+	password, ok := p.userPassword(booking)
+	if !ok {
+		return nil
+	}
+	if password == "" {
+		return ErrPasswordRequired
+	}
+	var permissions byte
+	if p.AllowPrint {
+		permissions |= fpdf.CnProtectPrint
+	}
+	pdf.SetProtection(permissions, password, p.OwnerPassword)
+	return nil
+}
+
+// Protected сообщает, будет ли документ бронирования зашифрован паролем
+func (r *Renderer) Protected(booking models.RequestData) bool {
+	_, ok := r.options.Protection.userPassword(booking)
+	return ok
+}
+
+// MissingPassword сообщает, что документ нужно зашифровать, но пароля для него нет
+func (r *Renderer) MissingPassword(booking models.RequestData) bool {
+	password, ok := r.options.Protection.userPassword(booking)
+	return ok && password == ""
+}
@@ -0,0 +1,72 @@
+package pdf
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed layouts/*.json
+var builtinLayouts embed.FS
+
+// Registry - набор рендереров по типам документов
+type Registry struct {
+	renderers map[string]*Renderer
+}
+
+// LoadRegistry загружает встроенные макеты (eticket, invoice, boarding_pass) и макеты из overrides,
+// где ключ - тип документа, значение - путь к JSON-макету. Через overrides можно добавить и новый тип.
+// options - общие настройки рендера для всех макетов
+func LoadRegistry(overrides map[string]string, options Options) (*Registry, error) {
+	registry := &Registry{renderers: make(map[string]*Renderer)}
+
+	entries, err := builtinLayouts.ReadDir("layouts")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read builtin layouts: %w", err)
+	}
+	for _, entry := range entries {
+		documentType := strings.TrimSuffix(entry.Name(), ".json")
+		if _, ok := overrides[documentType]; ok {
+			continue
+		}
+		data, err := builtinLayouts.ReadFile(path.Join("layouts", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read builtin layout %s: %w", entry.Name(), err)
+		}
+		layout, err := ParseLayout(data)
+		if err != nil {
+			return nil, fmt.Errorf("builtin layout %s: %w", documentType, err)
+		}
+		registry.renderers[documentType] = NewRenderer(layout, options)
+	}
+
+	for documentType, layoutPath := range overrides {
+		layout, err := LoadLayout(layoutPath)
+		if err != nil {
+			return nil, fmt.Errorf("layout %s: %w", documentType, err)
+		}
+		registry.renderers[documentType] = NewRenderer(layout, options)
+	}
+
+	return registry, nil
+}
+
+func (r *Registry) Renderer(documentType string) (*Renderer, error) {
+	renderer, ok := r.renderers[documentType]
+	if !ok {
+		return nil, fmt.Errorf("unknown document type %q", documentType)
+	}
+	return renderer, nil
+}
+
+// DocumentTypes возвращает отсортированный список поддерживаемых типов документов
+func (r *Registry) DocumentTypes() []string {
+	types := make([]string, 0, len(r.renderers))
+	for documentType := range r.renderers {
+		types = append(types, documentType)
+	}
+	sort.Strings(types)
+	return types
+}
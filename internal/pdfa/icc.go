@@ -0,0 +1,107 @@
+package pdfa
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// sRGBProfile - профиль ICC v2 для sRGB IEC61966-2.1, нужен для OutputIntent. Профиль собирается
+// из основных цветов sRGB, приведённых к D50, и кривой передачи sRGB, чтобы не хранить бинарный файл
+var sRGBProfile = buildSRGBProfile()
+
+const sRGBDescription = "sRGB IEC61966-2.1"
+
+type iccTag struct {
+	signature string
+	data      []byte
+}
+
+func buildSRGBProfile() []byte {
+	curve := sRGBCurve()
+	tags := []iccTag{
+		{"desc", iccDescription(sRGBDescription)},
+		{"cprt", iccText("No copyright, use freely")},
+		{"wtpt", iccXYZ(0.9642, 1.0, 0.8249)},
+		{"rXYZ", iccXYZ(0.4361, 0.2225, 0.0139)},
+		{"gXYZ", iccXYZ(0.3851, 0.7169, 0.0971)},
+		{"bXYZ", iccXYZ(0.1431, 0.0606, 0.7141)},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	// Заголовок - 128 байт, за ним таблица тегов и данные тегов с выравниванием по 4 байта
+	offset := 128 + 4 + len(tags)*12
+	var table, data bytes.Buffer
+	binary.Write(&table, binary.BigEndian, uint32(len(tags)))
+	for _, tag := range tags {
+		table.WriteString(tag.signature)
+		binary.Write(&table, binary.BigEndian, uint32(offset+data.Len()))
+		binary.Write(&table, binary.BigEndian, uint32(len(tag.data)))
+		data.Write(tag.data)
+		for data.Len()%4 != 0 {
+			data.WriteByte(0)
+		}
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[0:], uint32(offset+data.Len()))
+	binary.BigEndian.PutUint32(header[8:], 0x02100000) // версия 2.1
+	copy(header[12:], "mntr")
+	copy(header[16:], "RGB ")
+	copy(header[20:], "XYZ ")
+	binary.BigEndian.PutUint16(header[24:], 2000) // дата создания: 2000-01-01
+	binary.BigEndian.PutUint16(header[26:], 1)
+	binary.BigEndian.PutUint16(header[28:], 1)
+	copy(header[36:], "acsp")
+	copy(header[68:], iccXYZ(0.9642, 1.0, 0.8249)[8:]) // освещение PCS - D50
+
+	profile := append(header, table.Bytes()...)
+	return append(profile, data.Bytes()...)
+}
+
+func iccXYZ(x, y, z float64) []byte {
+	b := make([]byte, 20)
+	copy(b, "XYZ ")
+	for i, v := range []float64{x, y, z} {
+		binary.BigEndian.PutUint32(b[8+i*4:], uint32(int32(math.Round(v*65536))))
+	}
+	return b
+}
+
+func iccText(text string) []byte {
+	b := make([]byte, 8, 8+len(text)+1)
+	copy(b, "text")
+	return append(append(b, text...), 0)
+}
+
+// iccDescription - textDescriptionType: строка ASCII, пустые Unicode и ScriptCode
+func iccDescription(text string) []byte {
+	var b bytes.Buffer
+	b.WriteString("desc")
+	b.Write(make([]byte, 4))
+	binary.Write(&b, binary.BigEndian, uint32(len(text)+1))
+	b.WriteString(text)
+	b.WriteByte(0)
+	b.Write(make([]byte, 4+4+2+1+67))
+	return b.Bytes()
+}
+
+// sRGBCurve - табличная кривая передачи sRGB на 1024 точки
+func sRGBCurve() []byte {
+	const points = 1024
+	b := make([]byte, 12+points*2)
+	copy(b, "curv")
+	binary.BigEndian.PutUint32(b[8:], points)
+	for i := 0; i < points; i++ {
+		v := float64(i) / (points - 1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		binary.BigEndian.PutUint16(b[12+i*2:], uint16(math.Round(v*65535)))
+	}
+	return b
+}
@@ -0,0 +1,184 @@
+// Package pdfa переводит PDF после fpdf в PDF/A-3b: заголовок 1.7 с двоичным комментарием, /ID в трейлере,
+// метаданные XMP, OutputIntent с профилем sRGB и вложенные файлы со связью /AF.
+// Шрифты fpdf встраивает сам, шифрование в PDF/A запрещено
+package pdfa
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"pdf-microservice/internal/pdfdoc"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Producer записывается в сведения о документе и в XMP
+const Producer = "pdf-microservice"
+
+// namesPattern - словарь /Names каталога fpdf с пустым списком вложений, заменяется своим
+var namesPattern = regexp.MustCompile(`(?s)/Names\s*<<.*?>>\s*>>`)
+
+// Attachment - вложенный файл, связанный с документом (associated file PDF/A-3)
+type Attachment struct {
+	// Name - имя файла латиницей, без скобок и обратной косой черты
+	Name        string
+	Description string
+	// MIME - тип содержимого, например application/json
+	MIME    string
+	Content []byte
+	// Relationship - связь с документом: Data, Source, Alternative, Supplement
+	Relationship string
+}
+
+// Metadata - сведения о документе, попадают и в словарь Info, и в XMP
+type Metadata struct {
+	Title     string
+	CreatedAt time.Time
+}
+
+// Convert переписывает документ в PDF/A-3b и вкладывает в него attachments
+func Convert(data []byte, metadata Metadata, attachments ...Attachment) ([]byte, error) {
+	doc, err := pdfdoc.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := doc.Object(doc.Root)
+	if err != nil {
+		return nil, err
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		return nil, err
+	}
+	isPage := make(map[int]bool, len(pages))
+	for _, page := range pages {
+		isPage[page] = true
+	}
+
+	w := pdfdoc.NewRewrite(doc, "1.7")
+	w.SetID(md5.Sum(data))
+
+	for _, number := range doc.Objects() {
+		if number == doc.Root || number == doc.Info {
+			continue
+		}
+		body, err := doc.Object(number)
+		if err != nil {
+			return nil, err
+		}
+		// Аннотации в PDF/A должны печататься: ссылкам fpdf не хватает флага Print
+		if isPage[number] {
+			body = bytes.ReplaceAll(body, []byte("/Subtype /Link "), []byte("/Subtype /Link /F 4 "))
+		}
+		w.Write(number, body)
+	}
+
+	created := metadata.CreatedAt.UTC().Truncate(time.Second)
+	info := doc.Info
+	if info == 0 {
+		info = w.Reserve()
+	}
+	w.Write(info, []byte(fmt.Sprintf("<<\n/Title %s\n/Producer %s\n/CreationDate %s\n/ModDate %s\n>>",
+		pdfdoc.Text(metadata.Title), pdfdoc.Text(Producer), pdfdoc.Date(created), pdfdoc.Date(created))))
+
+	xmp := xmpMetadata(metadata.Title, created)
+	metadataNumber := w.Reserve()
+	w.Write(metadataNumber, []byte(fmt.Sprintf("<< /Type /Metadata /Subtype /XML /Length %d >>\nstream\n%s\nendstream", len(xmp), xmp)))
+
+	profileNumber := w.Reserve()
+	w.Write(profileNumber, []byte(fmt.Sprintf("<< /N 3 /Length %d >>\nstream\n%s\nendstream", len(sRGBProfile), sRGBProfile)))
+
+	var names, associated []string
+	for _, attachment := range attachments {
+		file, err := writeAttachment(w, attachment, created)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, fmt.Sprintf("(%s) %d 0 R", attachment.Name, file))
+		associated = append(associated, fmt.Sprintf("%d 0 R", file))
+	}
+
+	catalog = namesPattern.ReplaceAll(catalog, nil)
+	catalog = pdfdoc.WithEntry(catalog, fmt.Sprintf("/Metadata %d 0 R", metadataNumber))
+	catalog = pdfdoc.WithEntry(catalog, fmt.Sprintf("/OutputIntents [<< /Type /OutputIntent /S /GTS_PDFA1 /OutputConditionIdentifier (%s) /Info (%s) /DestOutputProfile %d 0 R >>]",
+		sRGBDescription, sRGBDescription, profileNumber))
+	if len(attachments) > 0 {
+		// Имена в дереве /EmbeddedFiles должны идти по возрастанию, attachments передаются уже упорядоченными
+		catalog = pdfdoc.WithEntry(catalog, fmt.Sprintf("/Names << /EmbeddedFiles << /Names [%s] >> >>\n/AF [%s]",
+			strings.Join(names, " "), strings.Join(associated, " ")))
+	}
+	w.Write(doc.Root, catalog)
+
+	return w.Finish(), nil
+}
+
+// writeAttachment записывает сжатый поток файла и его описание, возвращает номер описания (Filespec)
+func writeAttachment(w *pdfdoc.Writer, attachment Attachment, modified time.Time) (int, error) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	if _, err := zw.Write(attachment.Content); err != nil {
+		return 0, fmt.Errorf("failed to compress attachment: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return 0, fmt.Errorf("failed to compress attachment: %w", err)
+	}
+
+	relationship := attachment.Relationship
+	if relationship == "" {
+		relationship = "Data"
+	}
+
+	stream := w.Reserve()
+	w.Write(stream, []byte(fmt.Sprintf("<< /Type /EmbeddedFile /Subtype /%s /Params << /Size %d /ModDate %s >> /Filter /FlateDecode /Length %d >>\nstream\n%s\nendstream",
+		nameEscape(attachment.MIME), len(attachment.Content), pdfdoc.Date(modified), compressed.Len(), compressed.Bytes())))
+
+	file := w.Reserve()
+	w.Write(file, []byte(fmt.Sprintf("<< /Type /Filespec /F (%s) /UF %s /Desc %s /AFRelationship /%s /EF << /F %d 0 R /UF %d 0 R >> >>",
+		attachment.Name, pdfdoc.Text(attachment.Name), pdfdoc.Text(attachment.Description), relationship, stream, stream)))
+
+	return file, nil
+}
+
+// nameEscape кодирует символы, недопустимые в имени PDF, как #XX: application/json - application#2Fjson
+func nameEscape(name string) string {
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < '!' || c > '~' || strings.IndexByte("/#()<>[]{}%", c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// xmpMetadata - пакет XMP с идентификацией PDF/A-3b и теми же сведениями, что в словаре Info
+func xmpMetadata(title string, created time.Time) string {
+	var escaped strings.Builder
+	xml.EscapeText(&escaped, []byte(title))
+	date := created.Format(time.RFC3339)
+
+	return `<?xpacket begin="` + "\uFEFF" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+  <rdf:Description rdf:about=""
+    xmlns:pdfaid="http://www.aiim.org/pdfa/ns/id/"
+    xmlns:dc="http://purl.org/dc/elements/1.1/"
+    xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+    xmlns:pdf="http://ns.adobe.com/pdf/1.3/">
+   <pdfaid:part>3</pdfaid:part>
+   <pdfaid:conformance>B</pdfaid:conformance>
+   <dc:format>application/pdf</dc:format>
+   <dc:title><rdf:Alt><rdf:li xml:lang="x-default">` + escaped.String() + `</rdf:li></rdf:Alt></dc:title>
+   <xmp:CreateDate>` + date + `</xmp:CreateDate>
+   <xmp:ModifyDate>` + date + `</xmp:ModifyDate>
+   <pdf:Producer>` + Producer + `</pdf:Producer>
+  </rdf:Description>
+ </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`
+}
@@ -0,0 +1,188 @@
+// Package pdfdoc - разбор и дописывание готовых PDF после fpdf: подпись, PDF/A.
+// Разбор рассчитан на файлы fpdf: одна классическая таблица xref и объекты без потоков объектов
+package pdfdoc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	startxrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	sizePattern      = regexp.MustCompile(`/Size\s+(\d+)`)
+	rootPattern      = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	infoPattern      = regexp.MustCompile(`/Info\s+(\d+)\s+\d+\s+R`)
+	idPattern        = regexp.MustCompile(`/ID\s*\[\s*<[0-9A-Fa-f]*>\s*<[0-9A-Fa-f]*>\s*\]`)
+	kidsPattern      = regexp.MustCompile(`/Kids\s*\[([\d\sR]*)\]`)
+	refsPattern      = regexp.MustCompile(`(\d+)\s+\d+\s+R`)
+	pagesPattern     = regexp.MustCompile(`/Pages\s+(\d+)\s+\d+\s+R`)
+	mediaBoxPattern  = regexp.MustCompile(`/MediaBox\s*\[\s*([-\d.]+)\s+([-\d.]+)\s+([-\d.]+)\s+([-\d.]+)\s*\]`)
+)
+
+// ErrEncrypted - документ зашифрован паролем, такие документы не дописываются
+var ErrEncrypted = errors.New("document is encrypted")
+
+// Document - разобранная структура PDF: смещения объектов и ссылки из trailer
+type Document struct {
+	Data []byte
+	// Root, Info - номера объектов каталога и словаря сведений, Info = 0 - словаря нет
+	Root int
+	Info int
+	// Size - следующий свободный номер объекта
+	Size int
+	// ID - запись /ID из trailer как есть, пусто - идентификатора нет
+	ID string
+
+	startxref int
+	offsets   map[int]int
+}
+
+// Parse разбирает таблицу xref и trailer. Зашифрованные документы не разбираются - возвращается ErrEncrypted
+func Parse(data []byte) (*Document, error) {
+	match := startxrefPattern.FindSubmatch(data)
+	if match == nil {
+		return nil, errors.New("startxref not found")
+	}
+	doc := &Document{Data: data, offsets: make(map[int]int)}
+	doc.startxref, _ = strconv.Atoi(string(match[1]))
+	if doc.startxref >= len(data) || !bytes.HasPrefix(data[doc.startxref:], []byte("xref")) {
+		return nil, errors.New("unsupported cross-reference section, expected a classic xref table")
+	}
+
+	trailerAt := bytes.Index(data[doc.startxref:], []byte("trailer"))
+	if trailerAt < 0 {
+		return nil, errors.New("trailer not found")
+	}
+	table := data[doc.startxref+len("xref") : doc.startxref+trailerAt]
+	trailer := data[doc.startxref+trailerAt:]
+	if bytes.Contains(trailer, []byte("/Encrypt")) {
+		return nil, ErrEncrypted
+	}
+
+	// Подразделы таблицы: строка "первый номер количество", затем записи "смещение поколение n|f"
+	lines := bytes.Fields(table)
+	for i := 0; i+1 < len(lines); {
+		first, err1 := strconv.Atoi(string(lines[i]))
+		count, err2 := strconv.Atoi(string(lines[i+1]))
+		if err1 != nil || err2 != nil || i+2+count*3 > len(lines) {
+			return nil, errors.New("malformed xref table")
+		}
+		for j := 0; j < count; j++ {
+			entry := lines[i+2+j*3:]
+			if string(entry[2]) == "n" {
+				offset, err := strconv.Atoi(string(entry[0]))
+				if err != nil {
+					return nil, errors.New("malformed xref entry")
+				}
+				doc.offsets[first+j] = offset
+			}
+		}
+		i += 2 + count*3
+	}
+
+	var err error
+	if doc.Size, err = intMatch(sizePattern, trailer, "/Size"); err != nil {
+		return nil, err
+	}
+	if doc.Root, err = intMatch(rootPattern, trailer, "/Root"); err != nil {
+		return nil, err
+	}
+	doc.Info, _ = intMatch(infoPattern, trailer, "/Info")
+	doc.ID = string(idPattern.Find(trailer))
+
+	return doc, nil
+}
+
+func intMatch(pattern *regexp.Regexp, data []byte, name string) (int, error) {
+	match := pattern.FindSubmatch(data)
+	if match == nil {
+		return 0, fmt.Errorf("%s not found", name)
+	}
+	return strconv.Atoi(string(match[1]))
+}
+
+// Objects возвращает номера всех объектов документа по возрастанию
+func (d *Document) Objects() []int {
+	numbers := make([]int, 0, len(d.offsets))
+	for number := range d.offsets {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// Object возвращает тело объекта без "N 0 obj" и "endobj", вместе с потоком, если он есть
+func (d *Document) Object(number int) ([]byte, error) {
+	offset, ok := d.offsets[number]
+	if !ok || offset >= len(d.Data) {
+		return nil, fmt.Errorf("object %d not found", number)
+	}
+	body := d.Data[offset:]
+	start := bytes.Index(body, []byte("obj"))
+	end := bytes.Index(body, []byte("endobj"))
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("object %d is malformed", number)
+	}
+	return bytes.TrimSpace(body[start+len("obj") : end]), nil
+}
+
+// Pages возвращает номера объектов страниц по порядку. Дерево страниц fpdf плоское: все страницы в /Kids корня
+func (d *Document) Pages() ([]int, error) {
+	pages, err := d.pagesObject()
+	if err != nil {
+		return nil, err
+	}
+	kids := kidsPattern.FindSubmatch(pages)
+	if kids == nil {
+		return nil, errors.New("/Kids not found")
+	}
+	var numbers []int
+	for _, ref := range refsPattern.FindAllSubmatch(kids[1], -1) {
+		number, _ := strconv.Atoi(string(ref[1]))
+		numbers = append(numbers, number)
+	}
+	if len(numbers) == 0 {
+		return nil, errors.New("document has no pages")
+	}
+	return numbers, nil
+}
+
+func (d *Document) pagesObject() ([]byte, error) {
+	catalog, err := d.Object(d.Root)
+	if err != nil {
+		return nil, err
+	}
+	number, err := intMatch(pagesPattern, catalog, "/Pages")
+	if err != nil {
+		return nil, err
+	}
+	return d.Object(number)
+}
+
+// PageSize возвращает ширину и высоту страницы в пунктах: MediaBox страницы или унаследованную от дерева страниц
+func (d *Document) PageSize(number int) (width, height float64, err error) {
+	page, err := d.Object(number)
+	if err != nil {
+		return 0, 0, err
+	}
+	box := mediaBoxPattern.FindSubmatch(page)
+	if box == nil {
+		pages, err := d.pagesObject()
+		if err != nil {
+			return 0, 0, err
+		}
+		box = mediaBoxPattern.FindSubmatch(pages)
+	}
+	if box == nil {
+		return 0, 0, errors.New("/MediaBox not found")
+	}
+	var coords [4]float64
+	for i := range coords {
+		coords[i], _ = strconv.ParseFloat(string(box[i+1]), 64)
+	}
+	return coords[2] - coords[0], coords[3] - coords[1], nil
+}
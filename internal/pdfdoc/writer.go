@@ -0,0 +1,136 @@
+package pdfdoc
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// Writer собирает PDF из объектов. Инкрементальное обновление (NewUpdate) дописывает объекты после исходного
+// файла, не меняя его, и ссылается на прежнюю таблицу xref через /Prev; пересборка (NewRewrite) пишет файл заново
+type Writer struct {
+	buf     bytes.Buffer
+	offsets map[int]int
+	next    int
+	root    int
+	info    int
+	id      string
+	prev    int
+}
+
+// NewUpdate начинает инкрементальное обновление документа
+func NewUpdate(doc *Document) *Writer {
+	w := &Writer{offsets: make(map[int]int), next: doc.Size, root: doc.Root, info: doc.Info, id: doc.ID, prev: doc.startxref}
+	w.buf.Write(doc.Data)
+	if !bytes.HasSuffix(doc.Data, []byte("\n")) {
+		w.buf.WriteByte('\n')
+	}
+	return w
+}
+
+// NewRewrite начинает новый файл версии version с номерами объектов документа. Объекты документа
+// в него не копируются - их переписывает вызывающий
+func NewRewrite(doc *Document, version string) *Writer {
+	w := &Writer{offsets: make(map[int]int), next: doc.Size, root: doc.Root, info: doc.Info, id: doc.ID}
+	// Комментарий из байтов больше 127 после заголовка сообщает, что в файле есть двоичные данные
+	fmt.Fprintf(&w.buf, "%%PDF-%s\n%%\xE2\xE3\xCF\xD3\n", version)
+	return w
+}
+
+// SetID задаёт /ID трейлера: две строки по 16 байт, обычно одинаковые для нового файла
+func (w *Writer) SetID(id [16]byte) {
+	w.id = fmt.Sprintf("/ID [<%X> <%X>]", id, id)
+}
+
+// Reserve выделяет номер для нового объекта
+func (w *Writer) Reserve() int {
+	w.next++
+	return w.next - 1
+}
+
+// Write записывает объект number с телом body и запоминает его смещение
+func (w *Writer) Write(number int, body []byte) {
+	w.offsets[number] = w.buf.Len()
+	fmt.Fprintf(&w.buf, "%d 0 obj\n", number)
+	w.buf.Write(body)
+	w.buf.WriteString("\nendobj\n")
+}
+
+// Offset возвращает смещение записанного объекта в файле
+func (w *Writer) Offset(number int) int {
+	return w.offsets[number]
+}
+
+// Finish дописывает таблицу xref и trailer и возвращает файл целиком
+func (w *Writer) Finish() []byte {
+	xref := w.buf.Len()
+	w.buf.WriteString("xref\n")
+	if w.prev == 0 {
+		w.buf.WriteString("0 1\n0000000000 65535 f \n")
+	}
+
+	numbers := make([]int, 0, len(w.offsets))
+	for number := range w.offsets {
+		numbers = append(numbers, number)
+	}
+	sort.Ints(numbers)
+
+	// Подряд идущие номера объектов записываются одним подразделом
+	for i := 0; i < len(numbers); {
+		j := i + 1
+		for j < len(numbers) && numbers[j] == numbers[j-1]+1 {
+			j++
+		}
+		fmt.Fprintf(&w.buf, "%d %d\n", numbers[i], j-i)
+		for _, number := range numbers[i:j] {
+			fmt.Fprintf(&w.buf, "%010d 00000 n \n", w.offsets[number])
+		}
+		i = j
+	}
+
+	fmt.Fprintf(&w.buf, "trailer\n<<\n/Size %d\n/Root %d 0 R\n", w.next, w.root)
+	if w.info != 0 {
+		fmt.Fprintf(&w.buf, "/Info %d 0 R\n", w.info)
+	}
+	if w.id != "" {
+		w.buf.WriteString(w.id + "\n")
+	}
+	if w.prev != 0 {
+		fmt.Fprintf(&w.buf, "/Prev %d\n", w.prev)
+	}
+	fmt.Fprintf(&w.buf, ">>\nstartxref\n%d\n%%%%EOF\n", xref)
+
+	return w.buf.Bytes()
+}
+
+// WithEntry добавляет в словарь запись перед закрывающими ">>"
+func WithEntry(dict []byte, entry string) []byte {
+	end := bytes.LastIndex(dict, []byte(">>"))
+	if end < 0 {
+		return dict
+	}
+	result := append([]byte(nil), dict[:end]...)
+	result = append(result, "\n"+entry+"\n"...)
+	return append(result, dict[end:]...)
+}
+
+// Text кодирует строку в UTF-16BE с BOM, как требует PDF для текстовых строк
+func Text(text string) string {
+	encoded := []uint16{0xFEFF}
+	encoded = append(encoded, utf16.Encode([]rune(text))...)
+	var b strings.Builder
+	b.WriteByte('<')
+	for _, unit := range encoded {
+		fmt.Fprintf(&b, "%04X", unit)
+	}
+	b.WriteByte('>')
+	return b.String()
+}
+
+// Date форматирует время как строку даты PDF в UTC
+func Date(t time.Time) string {
+	return "(D:" + t.UTC().Format("20060102150405") + "+00'00')"
+}
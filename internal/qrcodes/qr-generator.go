@@ -1,29 +1,31 @@
 package qrcodes
 
 import (
-	"bytes"
 	"fmt"
 	"github.com/skip2/go-qrcode"
-	"image"
-	"image/png"
+	"strings"
 )
 
-func GenerateQRCode(data string) ([]byte, error) {
-	qrCode, err := qrcode.Encode(data, qrcode.Medium, 512)
-	if err != nil {
-		return nil, err
-	}
+// Levels - уровни коррекции ошибок: доля модулей, которую можно потерять без потери данных
+var Levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,     // 7%
+	"M": qrcode.Medium,  // 15%
+	"Q": qrcode.High,    // 25%
+	"H": qrcode.Highest, // 30%
+}
 
-	var buf bytes.Buffer
-	img, _, err := image.Decode(bytes.NewReader(qrCode))
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode qr code: %w", err)
+// Encode кодирует data в матрицу модулей без рамки, true - тёмный модуль. level - L, M, Q или H
+func Encode(data, level string) ([][]bool, error) {
+	recovery, ok := Levels[strings.ToUpper(level)]
+	if !ok {
+		return nil, fmt.Errorf("unknown error correction level %q", level)
 	}
 
-	err = png.Encode(&buf, img)
+	qrCode, err := qrcode.New(data, recovery)
 	if err != nil {
-		return nil, fmt.Errorf("failed to encode qr code to png: %w", err)
+		return nil, err
 	}
+	qrCode.DisableBorder = true
 
-	return buf.Bytes(), nil
+	return qrCode.Bitmap(), nil
 }
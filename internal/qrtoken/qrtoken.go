@@ -0,0 +1,165 @@
+// Package qrtoken - подписанные токены для QR-кода документа. Токен несёт бронирование, пассажира и время
+// выпуска, подписан HMAC-SHA256 и проверяется сервисом без обращения к хранилищу
+package qrtoken
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	version = 1
+	// macSize - длина подписи в байтах: HMAC-SHA256, усечённый до 128 бит, чтобы QR оставался некрупным
+	macSize = 16
+	// minSecret - минимальная длина секрета в байтах
+	minSecret = 32
+	// fileHandle - первый байт подписанного имени файла, чтобы его нельзя было выдать за токен QR-кода
+	fileHandle = 'F'
+)
+
+var (
+	ErrMalformed = errors.New("malformed token")
+	ErrSignature = errors.New("invalid token signature")
+)
+
+// Claims - данные, которые несёт токен
+type Claims struct {
+	BookingID int `json:"booking_id"`
+	// Passenger - "ИМЯ/ФАМИЛИЯ", пусто для общего документа бронирования
+	Passenger     string `json:"passenger,omitempty"`
+	PassengerType string `json:"passenger_type,omitempty"`
+	DocumentType  string `json:"document_type"`
+	// Route - аэропорты маршрута: "VKO-IST-HAM", направления разделены пробелом
+	Route string `json:"route,omitempty"`
+	// Departure - первый вылет, nil - неизвестен
+	Departure *time.Time `json:"departure,omitempty"`
+	IssuedAt  time.Time  `json:"issued_at"`
+}
+
+// Issuer выпускает и проверяет токены
+type Issuer struct {
+	secret  []byte
+	baseURL string
+}
+
+// NewIssuer создаёт выпуск токенов с секретом secret. baseURL - внешний адрес сервиса: QR содержит
+// ссылку {baseURL}/verify/{token}, пусто - только сам токен
+func NewIssuer(secret, baseURL string) (*Issuer, error) {
+	if len(secret) < minSecret {
+		return nil, fmt.Errorf("token secret must be at least %d bytes", minSecret)
+	}
+	return &Issuer{secret: []byte(secret), baseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Token кодирует и подписывает claims: версия, поля в двоичном виде, затем подпись, всё в base64url
+func (i *Issuer) Token(claims Claims) string {
+	var b bytes.Buffer
+	b.WriteByte(version)
+	b.Write(binary.AppendUvarint(nil, uint64(claims.BookingID)))
+	b.Write(binary.AppendVarint(nil, claims.IssuedAt.Unix()))
+	var departure int64
+	if claims.Departure != nil {
+		departure = claims.Departure.Unix()
+	}
+	b.Write(binary.AppendVarint(nil, departure))
+	for _, field := range []string{claims.DocumentType, claims.Passenger, claims.PassengerType, claims.Route} {
+		b.Write(binary.AppendUvarint(nil, uint64(len(field))))
+		b.WriteString(field)
+	}
+	b.Write(i.mac(b.Bytes()))
+	return base64.RawURLEncoding.EncodeToString(b.Bytes())
+}
+
+// URL возвращает содержимое QR-кода: ссылку на проверку или сам токен, если адрес сервиса не задан
+func (i *Issuer) URL(claims Claims) string {
+	token := i.Token(claims)
+	if i.baseURL == "" {
+		return token
+	}
+	return i.baseURL + "/verify/" + token
+}
+
+// Parse проверяет подпись токена и возвращает его данные
+func (i *Issuer) Parse(token string) (Claims, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(data) < 1+macSize {
+		return Claims{}, ErrMalformed
+	}
+	payload, mac := data[:len(data)-macSize], data[len(data)-macSize:]
+	if !hmac.Equal(mac, i.mac(payload)) {
+		return Claims{}, ErrSignature
+	}
+	if payload[0] != version {
+		return Claims{}, fmt.Errorf("%w: unsupported version %d", ErrMalformed, payload[0])
+	}
+
+	r := bytes.NewReader(payload[1:])
+	var claims Claims
+	booking, err := binary.ReadUvarint(r)
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+	claims.BookingID = int(booking)
+	issued, err := binary.ReadVarint(r)
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+	claims.IssuedAt = time.Unix(issued, 0).UTC()
+	departure, err := binary.ReadVarint(r)
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+	if departure != 0 {
+		at := time.Unix(departure, 0).UTC()
+		claims.Departure = &at
+	}
+	for _, field := range []*string{&claims.DocumentType, &claims.Passenger, &claims.PassengerType, &claims.Route} {
+		length, err := binary.ReadUvarint(r)
+		if err != nil || length > uint64(r.Len()) {
+			return Claims{}, ErrMalformed
+		}
+		value := make([]byte, length)
+		r.Read(value)
+		*field = string(value)
+	}
+	if r.Len() != 0 {
+		return Claims{}, ErrMalformed
+	}
+	return claims, nil
+}
+
+// FileHandle подписывает имя файла. По такому идентификатору GET /files/{id}/url выдаёт ссылку на файл,
+// а имена чужих файлов (номер бронирования и имя пассажира) перебрать нельзя
+func (i *Issuer) FileHandle(filename string) string {
+	payload := append([]byte{fileHandle}, filename...)
+	return base64.RawURLEncoding.EncodeToString(append(payload, i.mac(payload)...))
+}
+
+// ParseFileHandle проверяет подпись идентификатора файла и возвращает имя файла
+func (i *Issuer) ParseFileHandle(handle string) (string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(handle)
+	if err != nil || len(data) < 1+macSize {
+		return "", ErrMalformed
+	}
+	payload, mac := data[:len(data)-macSize], data[len(data)-macSize:]
+	if !hmac.Equal(mac, i.mac(payload)) {
+		return "", ErrSignature
+	}
+	if payload[0] != fileHandle {
+		return "", ErrMalformed
+	}
+	return string(payload[1:]), nil
+}
+
+func (i *Issuer) mac(payload []byte) []byte {
+	h := hmac.New(sha256.New, i.secret)
+	h.Write(payload)
+	return h.Sum(nil)[:macSize]
+}
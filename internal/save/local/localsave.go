@@ -1,26 +1,74 @@
 package local
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"path/filepath"
-	"pdf-microservice/internal/options"
+	"pdf-microservice/internal/save"
 )
 
-func SaveLocalPDF(cfg *options.Config, filename string, pdfBytes []byte) error {
+// Storage хранит билеты в каталоге на локальном диске
+type Storage struct {
+	dir string
+}
 
-	if _, err := os.Stat(cfg.S3.FilePath); os.IsNotExist(err) {
-		err = os.Mkdir(cfg.S3.FilePath, os.ModeDir|0755)
-		if err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", cfg.Api.DirName, err)
-		}
+func NewStorage(dir string) (*Storage, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory %s: %w", dir, err)
 	}
+	return &Storage{dir: dir}, nil
+}
 
-	filePath := filepath.Join(cfg.Api.DirName, filename)
-	err := ioutil.WriteFile(filePath, pdfBytes, 0644)
+func (s *Storage) Put(_ context.Context, key string, data []byte, _ string) error {
+	err := os.WriteFile(s.path(key), data, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to save pdf to file: %w", err)
 	}
 	return nil
 }
+
+func (s *Storage) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, save.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pdf from file: %w", err)
+	}
+	return data, nil
+}
+
+func (s *Storage) Delete(_ context.Context, key string) error {
+	err := os.Remove(s.path(key))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to delete pdf file: %w", err)
+	}
+	return nil
+}
+
+func (s *Storage) Exists(_ context.Context, key string) (bool, error) {
+	_, err := os.Stat(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *Storage) URL(_ context.Context, key string) (string, error) {
+	path, err := filepath.Abs(s.path(key))
+	if err != nil {
+		return "", err
+	}
+	return "file://" + filepath.ToSlash(path), nil
+}
+
+// path отбрасывает каталоги из ключа, чтобы нельзя было выйти за пределы dir
+func (s *Storage) path(key string) string {
+	return filepath.Join(s.dir, filepath.Base(key))
+}
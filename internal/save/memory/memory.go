@@ -0,0 +1,56 @@
+package memory
+
+import (
+	"context"
+	"pdf-microservice/internal/save"
+	"sync"
+)
+
+// Storage хранит билеты в памяти процесса, подходит для стендов без S3 и тестов
+type Storage struct {
+	mu      sync.RWMutex
+	objects map[string][]byte
+}
+
+func NewStorage() *Storage {
+	return &Storage{objects: make(map[string][]byte)}
+}
+
+func (s *Storage) Put(_ context.Context, key string, data []byte, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (s *Storage) Get(_ context.Context, key string) ([]byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, ok := s.objects[key]
+	if !ok {
+		return nil, save.ErrNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (s *Storage) Delete(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *Storage) Exists(_ context.Context, key string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.objects[key]
+	return ok, nil
+}
+
+func (s *Storage) URL(_ context.Context, key string) (string, error) {
+	return "memory://" + key, nil
+}
@@ -0,0 +1,79 @@
+package retry
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrCircuitOpen = errors.New("storage circuit breaker is open")
+
+// Breaker - предохранитель: после threshold сбоев подряд запросы отклоняются без обращения
+// к хранилищу, пока не пройдёт cooldown. Затем пропускается один пробный запрос: удача
+// замыкает цепь, сбой размыкает её снова
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker создаёт предохранитель, threshold <= 0 - предохранитель выключен
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// Allow сообщает, можно ли обратиться к хранилищу. После Allow вызывающий обязан сообщить
+// результат через Success или Failure
+func (b *Breaker) Allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if b.probing || time.Since(b.openedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+// Success отмечает удачный запрос
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure отмечает сбой хранилища и возвращает true, если цепь только что разомкнулась
+func (b *Breaker) Failure() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasOpen := b.failures >= b.threshold
+	b.failures++
+	b.probing = false
+	if b.threshold <= 0 || b.failures < b.threshold {
+		return false
+	}
+	b.openedAt = time.Now()
+	return !wasOpen
+}
+
+// Cancel отменяет обращение без результата: запрос прервал вызывающий, о хранилище это ничего не говорит
+func (b *Breaker) Cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
@@ -0,0 +1,164 @@
+// Package retry оборачивает хранилище повторами с экспоненциальной задержкой и предохранителем,
+// чтобы кратковременный сбой хранилища не терял документы, а долгий - не задерживал каждый запрос
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"pdf-microservice/internal/save"
+	"time"
+)
+
+// ErrUnavailable оборачивает временную ошибку, которая не прошла и после всех повторов
+var ErrUnavailable = errors.New("storage unavailable")
+
+// Options - настройки повторов. Attempts - сколько всего попыток (минимум одна), BaseDelay - задержка
+// перед второй попыткой, дальше она удваивается до MaxDelay; к задержке добавляется случайная
+// составляющая, чтобы запросы не повторялись одновременно. AttemptTimeout - предел одной попытки, 0 - нет.
+// Transient решает, имеет ли смысл повторять ошибку, nil - повторяются все ошибки
+type Options struct {
+	Attempts       int
+	BaseDelay      time.Duration
+	MaxDelay       time.Duration
+	AttemptTimeout time.Duration
+	Transient      func(error) bool
+}
+
+// Storage повторяет операции вложенного хранилища. Отсутствие объекта, отмена контекста
+// и неповторяемые ошибки возвращаются сразу. URL не обращается к хранилищу и не повторяется
+type Storage struct {
+	next    save.Storage
+	options Options
+	breaker *Breaker
+}
+
+// NewStorage оборачивает next, breaker может быть nil
+func NewStorage(next save.Storage, options Options, breaker *Breaker) *Storage {
+	if options.Attempts < 1 {
+		options.Attempts = 1
+	}
+	if breaker == nil {
+		breaker = NewBreaker(0, 0)
+	}
+	return &Storage{next: next, options: options, breaker: breaker}
+}
+
+func (s *Storage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	return s.do(ctx, "put "+key, func(ctx context.Context) error {
+		return s.next.Put(ctx, key, data, contentType)
+	})
+}
+
+func (s *Storage) Get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := s.do(ctx, "get "+key, func(ctx context.Context) error {
+		var err error
+		data, err = s.next.Get(ctx, key)
+		return err
+	})
+	return data, err
+}
+
+func (s *Storage) Delete(ctx context.Context, key string) error {
+	return s.do(ctx, "delete "+key, func(ctx context.Context) error {
+		return s.next.Delete(ctx, key)
+	})
+}
+
+func (s *Storage) Exists(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := s.do(ctx, "stat "+key, func(ctx context.Context) error {
+		var err error
+		exists, err = s.next.Exists(ctx, key)
+		return err
+	})
+	return exists, err
+}
+
+func (s *Storage) URL(ctx context.Context, key string) (string, error) {
+	return s.next.URL(ctx, key)
+}
+
+// do выполняет op, повторяя её при временных ошибках, пока не кончатся попытки или контекст
+func (s *Storage) do(ctx context.Context, name string, op func(context.Context) error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		if open := s.breaker.Allow(); open != nil {
+			if err != nil {
+				return fmt.Errorf("%w, last error: %v", open, err)
+			}
+			return open
+		}
+
+		err = s.attempt(ctx, op)
+		switch {
+		case err == nil:
+			s.breaker.Success()
+			return nil
+		case ctx.Err() != nil, errors.Is(err, context.Canceled):
+			// Запрос, задача или вложенное хранилище отменили операцию раньше ответа - это не сбой хранилища
+			s.breaker.Cancel()
+			return err
+		case !s.transient(err):
+			// Хранилище ответило, пусть и ошибкой, значит оно доступно
+			s.breaker.Success()
+			return err
+		}
+
+		if s.breaker.Failure() {
+			log.Printf("Storage circuit opened after %s failed: %v", name, err)
+		}
+		if attempt >= s.options.Attempts {
+			return fmt.Errorf("%w: %w (after %d attempts)", ErrUnavailable, err, attempt)
+		}
+
+		delay := s.delay(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return fmt.Errorf("%w: %w (after %d attempts, no time left to retry)", ErrUnavailable, err, attempt)
+		}
+		log.Printf("Storage %s failed (attempt %d/%d), retrying in %s: %v", name, attempt, s.options.Attempts, delay, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Storage) attempt(ctx context.Context, op func(context.Context) error) error {
+	if s.options.AttemptTimeout <= 0 {
+		return op(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.options.AttemptTimeout)
+	defer cancel()
+	return op(ctx)
+}
+
+func (s *Storage) transient(err error) bool {
+	if errors.Is(err, save.ErrNotFound) {
+		return false
+	}
+	return s.options.Transient == nil || s.options.Transient(err)
+}
+
+// delay - задержка перед попыткой attempt+1: BaseDelay * 2^(attempt-1), не больше MaxDelay,
+// из которой случайна вторая половина
+func (s *Storage) delay(attempt int) time.Duration {
+	delay := s.options.BaseDelay
+	for i := 1; i < attempt && (s.options.MaxDelay <= 0 || delay < s.options.MaxDelay); i++ {
+		delay *= 2
+	}
+	if s.options.MaxDelay > 0 && delay > s.options.MaxDelay {
+		delay = s.options.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return delay/2 + rand.N(delay/2+1)
+}
@@ -3,16 +3,38 @@ package s3_storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+	"net/http"
+	"net/url"
 	"pdf-microservice/internal/options"
+	"pdf-microservice/internal/save"
+	"strings"
+	"time"
 )
 
+const keyPrefix = "tickets/"
+
+// maxURLExpiry - наибольший срок подписанной ссылки в SigV4
+const maxURLExpiry = 7 * 24 * time.Hour
+
 func NewS3Client(cfg *options.Config) (*minio.Client, error) {
 
-	client, err := minio.New(cfg.S3.Endpoint, &minio.Options{
-		Creds: credentials.NewStaticV4(cfg.S3.AccessKeyID, cfg.S3.SecretAccessKey, ""),
+	host, secure, err := parseEndpoint(cfg.S3.Endpoint, cfg.S3.UseSSL)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := minio.New(host, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.S3.AccessKeyID, cfg.S3.SecretAccessKey, ""),
+		Secure: secure,
+		// С известным регионом ссылки подписываются без запроса расположения бакета
+		Region: cfg.S3.Region,
+		// Повторами управляет retry.Storage, собственные повторы клиента отключены
+		MaxRetries: 1,
 	})
 
 	if err != nil {
@@ -22,18 +44,125 @@ func NewS3Client(cfg *options.Config) (*minio.Client, error) {
 	return client, nil
 }
 
-func UploadFile(cfg *options.Config, client *minio.Client, filename string, fileBytes []byte) error {
+// parseEndpoint принимает адрес S3 со схемой (https://s3.timeweb.com) или без неё (s3.timeweb.com).
+// Схема в адресе важнее use_ssl
+func parseEndpoint(endpoint string, useSSL bool) (string, bool, error) {
+	if !strings.Contains(endpoint, "://") {
+		return strings.TrimSuffix(endpoint, "/"), useSSL, nil
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid s3 endpoint %q: %w", endpoint, err)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return "", false, fmt.Errorf("s3 endpoint %q must not have a path", endpoint)
+	}
+	switch u.Scheme {
+	case "https":
+		return u.Host, true, nil
+	case "http":
+		return u.Host, false, nil
+	default:
+		return "", false, fmt.Errorf("s3 endpoint %q has unsupported scheme %q", endpoint, u.Scheme)
+	}
+}
+
+// Storage хранит билеты в бакете S3 под префиксом tickets/ и выдаёт на них подписанные ссылки
+type Storage struct {
+	client    *minio.Client
+	bucket    string
+	urlExpiry time.Duration
+}
+
+func NewStorage(cfg *options.Config, client *minio.Client) (*Storage, error) {
+	if cfg.S3.URLExpiry <= 0 || cfg.S3.URLExpiry > maxURLExpiry {
+		return nil, fmt.Errorf("s3.url_expiry must be between 1s and %s, got %s", maxURLExpiry, cfg.S3.URLExpiry)
+	}
+	return &Storage{
+		client:    client,
+		bucket:    cfg.S3.BucketName,
+		urlExpiry: cfg.S3.URLExpiry,
+	}, nil
+}
 
-	key := fmt.Sprintf("tickets/" + filename)
+func (s *Storage) Put(ctx context.Context, key string, data []byte, contentType string) error {
 
 	// Загрузка файла в S3
-	_, err := client.PutObject(context.Background(), cfg.S3.BucketName, key, bytes.NewReader(fileBytes), int64(len(fileBytes)), minio.PutObjectOptions{
-		ContentType: "application/pdf",
+	_, err := s.client.PutObject(ctx, s.bucket, keyPrefix+key, bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType: contentType,
 	})
 	if err != nil {
 		return err
 	}
 
 	return nil
+}
+
+func (s *Storage) Get(ctx context.Context, key string) ([]byte, error) {
+	obj, err := s.client.GetObject(ctx, s.bucket, keyPrefix+key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	data, err := io.ReadAll(obj)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, save.ErrNotFound
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *Storage) Delete(ctx context.Context, key string) error {
+	return s.client.RemoveObject(ctx, s.bucket, keyPrefix+key, minio.RemoveObjectOptions{})
+}
+
+func (s *Storage) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.client.StatObject(ctx, s.bucket, keyPrefix+key, minio.StatObjectOptions{})
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// URL возвращает подписанную ссылку на скачивание, действующую s3.url_expiry. Ссылка подписывается
+// без обращения к S3 и годится и для объекта, который ещё не загружен
+func (s *Storage) URL(ctx context.Context, key string) (string, error) {
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, keyPrefix+key, s.urlExpiry, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign url: %w", err)
+	}
+	return u.String(), nil
+}
+
+// IsTransient сообщает, что ошибку S3 имеет смысл повторить: сеть, таймаут, 5xx, 408, 429 и SlowDown.
+// Ошибки доступа, отсутствие бакета, неверные запросы и отменённый контекст не повторяются.
+// Истёкший срок попытки (context.DeadlineExceeded) повторяется
+func IsTransient(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	resp := minio.ToErrorResponse(err)
+	switch resp.Code {
+	case "SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable":
+		return true
+	}
+	switch {
+	case resp.Code == "":
+		// Ответа от S3 нет: сетевая ошибка или таймаут попытки
+		return true
+	case resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	}
+	return resp.StatusCode >= http.StatusInternalServerError
+}
 
+func isNotFound(err error) bool {
+	return minio.ToErrorResponse(err).Code == "NoSuchKey"
 }
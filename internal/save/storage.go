@@ -0,0 +1,20 @@
+package save
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Storage - хранилище сгенерированных билетов. Ключ - имя файла билета,
+// префиксы и каталоги реализация добавляет сама
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+	Exists(ctx context.Context, key string) (bool, error)
+	// URL возвращает ссылку, по которой объект будет доступен после Put. Ссылка может действовать
+	// ограниченное время (подписанные ссылки S3), тогда её можно запросить заново
+	URL(ctx context.Context, key string) (string, error)
+}
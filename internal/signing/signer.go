@@ -0,0 +1,333 @@
+package signing
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/smallstep/pkcs7"
+	"os"
+	"pdf-microservice/internal/pdfdoc"
+	"strings"
+	"time"
+)
+
+// mmToPt - перевод миллиметров макета в пункты PDF
+const mmToPt = 72 / 25.4
+
+// byteRangePlaceholder заменяется на настоящие границы после сборки файла, ширина полей фиксирована,
+// чтобы смещения не сдвигались
+const byteRangePlaceholder = "/ByteRange [0 ********** ********** **********]"
+
+// ErrEncrypted - документ зашифрован паролем, такие документы не подписываются
+var ErrEncrypted = pdfdoc.ErrEncrypted
+
+// oidSigningCertificateV2 - атрибут signing-certificate-v2 (RFC 5035), обязательный для CAdES-BES:
+// привязывает подпись к сертификату подписанта
+var oidSigningCertificateV2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 16, 2, 47}
+
+type essCertIDv2 struct {
+	CertHash []byte
+}
+
+type signingCertificateV2 struct {
+	Certs []essCertIDv2
+}
+
+// Appearance - вид поля подписи. Rect - x, y, ширина и высота в миллиметрах от левого верхнего угла
+// первой страницы, учитывается только для видимой подписи
+type Appearance struct {
+	Visible bool
+	Rect    [4]float64
+}
+
+// Info - данные документа, которые записываются в словарь подписи и попадают под неё
+type Info struct {
+	BookingID int
+	// Passenger - "ИМЯ/ФАМИЛИЯ" пассажира, как в документе и токене QR-кода, пусто для общего документа бронирования
+	Passenger string
+	Document  string
+}
+
+// Signer подписывает PDF отсоединённой подписью CMS (PKCS#7) с атрибутами CAdES-BES
+type Signer struct {
+	key        crypto.Signer
+	chain      []*x509.Certificate
+	appearance Appearance
+}
+
+// NewSigner загружает из PEM цепочку сертификатов (первым - сертификат подписанта) и закрытый ключ
+// в PKCS#8, PKCS#1 или SEC 1
+func NewSigner(certFile, keyFile string, appearance Appearance) (*Signer, error) {
+	chain, err := loadCertificates(certFile)
+	if err != nil {
+		return nil, err
+	}
+	key, err := loadKey(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	if !publicKeysEqual(chain[0].PublicKey, key.Public()) {
+		return nil, errors.New("private key does not match the certificate")
+	}
+	if appearance.Visible && (appearance.Rect[2] <= 0 || appearance.Rect[3] <= 0) {
+		return nil, errors.New("signature rect must have positive width and height")
+	}
+	return &Signer{key: key, chain: chain, appearance: appearance}, nil
+}
+
+func loadCertificates(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read certificate: %w", err)
+	}
+	var chain []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return chain, nil
+}
+
+func loadKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		var key any
+		switch block.Type {
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key, err = x509.ParseECPrivateKey(block.Bytes)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("unsupported private key type")
+		}
+		return signer, nil
+	}
+	return nil, fmt.Errorf("no private key in %s", path)
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	switch key := a.(type) {
+	case *rsa.PublicKey:
+		return key.Equal(b)
+	case *ecdsa.PublicKey:
+		return key.Equal(b)
+	case ed25519.PublicKey:
+		return key.Equal(b)
+	}
+	return false
+}
+
+// Certificate возвращает сертификат подписанта
+func (s *Signer) Certificate() *x509.Certificate {
+	return s.chain[0]
+}
+
+// Visible сообщает, рисуется ли подпись на странице
+func (s *Signer) Visible() bool {
+	return s.appearance.Visible
+}
+
+// Sign добавляет к PDF поле подписи и подпись инкрементальным обновлением. Зашифрованные документы
+// не подписываются - возвращается ErrEncrypted
+func (s *Signer) Sign(data []byte, info Info) ([]byte, error) {
+	doc, err := pdfdoc.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	catalog, err := doc.Object(doc.Root)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(catalog, []byte("/AcroForm")) {
+		return nil, errors.New("document already has a form")
+	}
+	pages, err := doc.Pages()
+	if err != nil {
+		return nil, err
+	}
+	pageNumber := pages[0]
+	pageWidth, pageHeight, err := doc.PageSize(pageNumber)
+	if err != nil {
+		return nil, err
+	}
+	page, err := doc.Object(pageNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	u := pdfdoc.NewUpdate(doc)
+	sigNumber, widgetNumber := u.Reserve(), u.Reserve()
+
+	rect, appearance := "0 0 0 0", ""
+	if s.appearance.Visible {
+		x, y := s.appearance.Rect[0]*mmToPt, pageHeight-(s.appearance.Rect[1]+s.appearance.Rect[3])*mmToPt
+		w, h := s.appearance.Rect[2]*mmToPt, s.appearance.Rect[3]*mmToPt
+		if x < 0 || y < 0 || x+w > pageWidth+0.01 {
+			return nil, errors.New("signature rect is outside the first page")
+		}
+		rect = fmt.Sprintf("%.2f %.2f %.2f %.2f", x, y, x+w, y+h)
+
+		fontNumber, streamNumber := u.Reserve(), u.Reserve()
+		u.Write(fontNumber, []byte("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>"))
+		u.Write(streamNumber, s.appearanceStream(w, h, fontNumber, info, now))
+		appearance = fmt.Sprintf(" /AP << /N %d 0 R >>", streamNumber)
+	}
+
+	// Незащищённая область подписи - только значение /Contents, остальной словарь, включая
+	// номер бронирования и пассажира, подписывается вместе с документом
+	reserve := 4096
+	for _, cert := range s.chain {
+		reserve += len(cert.Raw)
+	}
+	sig := fmt.Sprintf("<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached\n%s\n/Contents <%s>\n/M %s\n/Name %s\n/Reason %s\n/Booking %d",
+		byteRangePlaceholder, strings.Repeat("0", reserve*2), pdfdoc.Date(now), pdfdoc.Text(s.signerName()),
+		pdfdoc.Text(fmt.Sprintf("Booking %d", info.BookingID)), info.BookingID)
+	if info.Passenger != "" {
+		sig += "\n/Passenger " + pdfdoc.Text(info.Passenger)
+	}
+	if info.Document != "" {
+		sig += "\n/Document /" + info.Document
+	}
+	u.Write(sigNumber, []byte(sig+"\n>>"))
+
+	// Флаги 132 - Print и Locked: поле печатается и не редактируется
+	u.Write(widgetNumber, []byte(fmt.Sprintf("<< /Type /Annot /Subtype /Widget /FT /Sig /T (Signature1) /F 132 /V %d 0 R /P %d 0 R /Rect [%s]%s >>",
+		sigNumber, pageNumber, rect, appearance)))
+	u.Write(doc.Root, pdfdoc.WithEntry(catalog, fmt.Sprintf("/AcroForm << /Fields [%d 0 R] /SigFlags 3 >>", widgetNumber)))
+
+	widgetRef := fmt.Sprintf("%d 0 R", widgetNumber)
+	switch {
+	case bytes.Contains(page, []byte("/Annots [")):
+		page = bytes.Replace(page, []byte("/Annots ["), []byte("/Annots ["+widgetRef+" "), 1)
+	case bytes.Contains(page, []byte("/Annots")):
+		return nil, errors.New("indirect page annotations are not supported")
+	default:
+		page = pdfdoc.WithEntry(page, "/Annots ["+widgetRef+"]")
+	}
+	u.Write(pageNumber, page)
+
+	signed := u.Finish()
+	return s.fill(signed, u.Offset(sigNumber))
+}
+
+// fill проставляет /ByteRange и записывает подпись всего файла, кроме значения /Contents
+func (s *Signer) fill(data []byte, sigOffset int) ([]byte, error) {
+	rangeAt := sigOffset + bytes.Index(data[sigOffset:], []byte(byteRangePlaceholder))
+	contentsAt := sigOffset + bytes.Index(data[sigOffset:], []byte("/Contents <")) + len("/Contents ")
+	contentsEnd := contentsAt + bytes.IndexByte(data[contentsAt:], '>') + 1
+
+	byteRange := fmt.Sprintf("/ByteRange [0 %-10d %-10d %-10d]", contentsAt, contentsEnd, len(data)-contentsEnd)
+	copy(data[rangeAt:], byteRange)
+
+	content := make([]byte, 0, len(data)-(contentsEnd-contentsAt))
+	content = append(content, data[:contentsAt]...)
+	content = append(content, data[contentsEnd:]...)
+
+	signature, err := s.signature(content)
+	if err != nil {
+		return nil, err
+	}
+	encoded := hex.EncodeToString(signature)
+	if len(encoded) > contentsEnd-contentsAt-2 {
+		return nil, errors.New("signature does not fit the reserved space")
+	}
+	copy(data[contentsAt+1:], encoded)
+
+	return data, nil
+}
+
+func (s *Signer) signature(content []byte) ([]byte, error) {
+	signedData, err := pkcs7.NewSignedData(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create signed data: %w", err)
+	}
+	signedData.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+
+	certHash := sha256.Sum256(s.chain[0].Raw)
+	config := pkcs7.SignerInfoConfig{ExtraSignedAttributes: []pkcs7.Attribute{{
+		Type:  oidSigningCertificateV2,
+		Value: signingCertificateV2{Certs: []essCertIDv2{{CertHash: certHash[:]}}},
+	}}}
+	if err = signedData.AddSignerChain(s.chain[0], s.key, s.chain[1:], config); err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+	signedData.Detach()
+
+	return signedData.Finish()
+}
+
+func (s *Signer) signerName() string {
+	if name := s.chain[0].Subject.CommonName; name != "" {
+		return name
+	}
+	return s.chain[0].Subject.String()
+}
+
+// appearanceStream рисует видимую подпись: рамку и три строки Helvetica, размер шрифта подбирается по высоте поля
+func (s *Signer) appearanceStream(w, h float64, fontNumber int, info Info, signedAt time.Time) []byte {
+	size := min(8, h/3.6)
+	lines := []string{
+		"Digitally signed by " + s.signerName(),
+		fmt.Sprintf("Booking %d", info.BookingID),
+		signedAt.Format("2006-01-02 15:04 MST"),
+	}
+
+	var content strings.Builder
+	fmt.Fprintf(&content, "q 0.4 0.4 0.4 RG 0.5 w 0.25 0.25 %.2f %.2f re S Q\n", w-0.5, h-0.5)
+	fmt.Fprintf(&content, "BT /F1 %.2f Tf 0 g %.2f TL 3 %.2f Td\n", size, size*1.2, h-size-2)
+	for _, line := range lines {
+		fmt.Fprintf(&content, "(%s) Tj T*\n", escapeLatin(line))
+	}
+	content.WriteString("ET")
+
+	return []byte(fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 %.2f %.2f] /Resources << /Font << /F1 %d 0 R >> >> /Length %d >>\nstream\n%s\nendstream",
+		w, h, fontNumber, content.Len(), content.String()))
+}
+
+// escapeLatin готовит строку для Helvetica: экранирует скобки и заменяет символы вне Latin-1 на "?"
+func escapeLatin(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0xFF:
+			b.WriteByte('?')
+		default:
+			b.WriteByte(byte(r))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,156 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"github.com/smallstep/pkcs7"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf16"
+)
+
+var (
+	byteRangePattern = regexp.MustCompile(`/ByteRange\s*\[\s*(\d+)\s+(\d+)\s+(\d+)\s+(\d+)\s*\]`)
+	contentsPattern  = regexp.MustCompile(`/Contents\s*<([0-9A-Fa-f]*)>`)
+	bookingPattern   = regexp.MustCompile(`/Booking\s+(\d+)`)
+	passengerPattern = regexp.MustCompile(`/Passenger\s*<([0-9A-Fa-f]*)>`)
+	documentPattern  = regexp.MustCompile(`/Document\s*/(\w+)`)
+)
+
+// Result - результат проверки подписи PDF
+type Result struct {
+	// Signed - в документе есть подпись
+	Signed bool `json:"signed"`
+	// Valid - подпись математически верна и после подписания в документ ничего не дописано
+	Valid bool `json:"valid"`
+	// Trusted - документ подписан сертификатом этого сервиса
+	Trusted bool `json:"trusted"`
+	// ModifiedAfterSigning - после подписанной части в файл дописаны данные
+	ModifiedAfterSigning bool       `json:"modified_after_signing"`
+	Signer               string     `json:"signer,omitempty"`
+	SignedAt             *time.Time `json:"signed_at,omitempty"`
+	BookingID            int        `json:"booking_id,omitempty"`
+	Passenger            string     `json:"passenger,omitempty"`
+	DocumentType         string     `json:"document_type,omitempty"`
+	Error                string     `json:"error,omitempty"`
+}
+
+// Verify проверяет последнюю подпись документа. trusted - сертификаты, подпись которыми считается
+// подписью сервиса, может быть nil
+func Verify(data []byte, trusted []*x509.Certificate) Result {
+	var result Result
+
+	at := bytes.LastIndex(data, []byte("/ByteRange"))
+	if at < 0 {
+		return result
+	}
+	result.Signed = true
+
+	// Словарь подписи - объект, в котором найден /ByteRange
+	start := bytes.LastIndex(data[:at], []byte("obj"))
+	end := bytes.Index(data[at:], []byte("endobj"))
+	if start < 0 || end < 0 {
+		result.Error = "malformed signature dictionary"
+		return result
+	}
+	dict := data[start : at+end]
+
+	ranges := byteRangePattern.FindSubmatch(dict)
+	contents := contentsPattern.FindSubmatchIndex(dict)
+	if ranges == nil || contents == nil {
+		result.Error = "signature dictionary has no /ByteRange or /Contents"
+		return result
+	}
+	var r [4]int
+	for i := range r {
+		r[i], _ = strconv.Atoi(string(ranges[i+1]))
+	}
+
+	// Пропуск между диапазонами должен совпадать со значением /Contents, иначе подписанные
+	// диапазоны могли быть подменены
+	hexStart := start + contents[2] - 1
+	hexEnd := start + contents[3] + 1
+	if r[0] != 0 || r[1] != hexStart || r[2] != hexEnd || r[2]+r[3] > len(data) {
+		result.Error = "byte range does not match the signature contents"
+		return result
+	}
+	result.ModifiedAfterSigning = r[2]+r[3] != len(data)
+
+	if match := bookingPattern.FindSubmatch(dict); match != nil {
+		result.BookingID, _ = strconv.Atoi(string(match[1]))
+	}
+	if match := passengerPattern.FindSubmatch(dict); match != nil {
+		result.Passenger = decodeText(match[1])
+	}
+	if match := documentPattern.FindSubmatch(dict); match != nil {
+		result.DocumentType = string(match[1])
+	}
+
+	der, err := hex.DecodeString(string(dict[contents[2]:contents[3]]))
+	if err != nil {
+		result.Error = "signature contents is not valid hex"
+		return result
+	}
+	// Значение /Contents дополнено нулями до зарезервированного размера
+	var raw asn1.RawValue
+	if _, err = asn1.Unmarshal(der, &raw); err != nil {
+		result.Error = "signature contents is not valid DER"
+		return result
+	}
+
+	p7, err := pkcs7.Parse(raw.FullBytes)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	p7.Content = append(append([]byte(nil), data[r[0]:r[0]+r[1]]...), data[r[2]:r[2]+r[3]]...)
+
+	signer := p7.GetOnlySigner()
+	if signer != nil {
+		result.Signer = signer.Subject.String()
+		for _, cert := range trusted {
+			if cert != nil && signer.Equal(cert) {
+				result.Trusted = true
+			}
+		}
+	}
+	var signedAt time.Time
+	if p7.UnmarshalSignedAttribute(pkcs7.OIDAttributeSigningTime, &signedAt) == nil {
+		result.SignedAt = &signedAt
+	}
+
+	if err = p7.Verify(); err != nil {
+		result.Error = err.Error()
+		result.Trusted = false
+		return result
+	}
+	result.Valid = !result.ModifiedAfterSigning
+	if result.ModifiedAfterSigning {
+		result.Error = "document was modified after signing"
+	}
+
+	return result
+}
+
+// decodeText разбирает hex-строку PDF в UTF-16BE с BOM, без BOM байты считаются Latin-1
+func decodeText(encoded []byte) string {
+	data, err := hex.DecodeString(string(encoded))
+	if err != nil {
+		return ""
+	}
+	if len(data) < 2 || data[0] != 0xFE || data[1] != 0xFF {
+		runes := make([]rune, len(data))
+		for i, b := range data {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	units := make([]uint16, 0, len(data)/2-1)
+	for i := 2; i+1 < len(data); i += 2 {
+		units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
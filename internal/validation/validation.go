@@ -0,0 +1,413 @@
+package validation
+
+import (
+	"fmt"
+	"pdf-microservice/internal/airports"
+	"pdf-microservice/internal/bcbp"
+	"pdf-microservice/internal/itinerary"
+	"pdf-microservice/internal/models"
+	"pdf-microservice/internal/money"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout = "2006-01-02"
+	// durationTolerance - допустимое расхождение переданной длительности с рассчитанной (округление до минут)
+	durationTolerance = time.Minute
+)
+
+var (
+	airportCode  = regexp.MustCompile(`^[A-Z]{3}$`)
+	carrierCode  = regexp.MustCompile(`^[A-Z0-9]{2,3}$`)
+	currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+	seatNumber   = regexp.MustCompile(`^[0-9]{1,3}[A-Z]$`)
+	// Пароль PDF дополняется до 32 байт, длиннее - обрезается, поэтому допускаются только ASCII до 32 символов
+	pdfPassword = regexp.MustCompile(`^[\x20-\x7E]{1,32}$`)
+)
+
+// FieldError - ошибка в конкретном поле запроса, Field - путь вида [0].ticket.itineraries[1].segments[0].arrival_time
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+type validator struct {
+	errors []FieldError
+}
+
+func (v *validator) add(field, format string, args ...any) {
+	v.errors = append(v.errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(field, value string) bool {
+	if value == "" {
+		v.add(field, "is required")
+		return false
+	}
+	return true
+}
+
+func (v *validator) match(field, value string, re *regexp.Regexp, expected string) {
+	if v.required(field, value) && !re.MatchString(value) {
+		v.add(field, "must be %s, got %q", expected, value)
+	}
+}
+
+// Validate проверяет бронирования до генерации, чтобы некорректные данные не доходили до рендера
+func Validate(requestData []models.RequestData) []FieldError {
+	v := &validator{}
+
+	if len(requestData) == 0 {
+		v.add("", "at least one booking is required")
+	}
+
+	// Имена файлов строятся из номера бронирования и типа документа, повтор перезаписал бы файлы другого бронирования
+	seen := make(map[string]int, len(requestData))
+
+	for i, booking := range requestData {
+		path := fmt.Sprintf("[%d]", i)
+		key := fmt.Sprintf("%d/%s", booking.Ticket.ID, booking.Document())
+		if first, ok := seen[key]; ok {
+			v.add(path+".ticket.id", "booking %d with document_type %s is already in the request at [%d]", booking.Ticket.ID, booking.Document(), first)
+		} else {
+			seen[key] = i
+		}
+		switch booking.Combined {
+		case models.CombinedNone, models.CombinedAlongside, models.CombinedOnly:
+		default:
+			v.add(path+".combined", "must be %s or %s, got %q", models.CombinedAlongside, models.CombinedOnly, booking.Combined)
+		}
+		if protection := booking.Protection; protection != nil && protection.Password != "" {
+			// Пароль не повторяется в ответе
+			if !pdfPassword.MatchString(protection.Password) {
+				v.add(path+".protection.password", "must be up to 32 printable ASCII characters")
+			}
+			if protection.Enabled != nil && !*protection.Enabled {
+				v.add(path+".protection.password", "is set, but protection is disabled")
+			}
+		}
+		if protection := booking.Protection; booking.PDFA != nil && *booking.PDFA && protection != nil &&
+			(protection.Password != "" || protection.Enabled != nil && *protection.Enabled) {
+			v.add(path+".pdfa", "PDF/A documents cannot be password protected")
+		}
+		dates := v.ticket(path+".ticket", booking.Ticket)
+		v.user(path+".user", booking.User, dates)
+		v.seats(path, booking)
+	}
+
+	return v.errors
+}
+
+// tripDates - первый вылет и последний прилёт, по ним проверяются возраст пассажиров и срок действия паспортов
+type tripDates struct {
+	firstDeparture time.Time
+	lastArrival    time.Time
+}
+
+func (v *validator) ticket(path string, ticket models.Ticket) tripDates {
+	if ticket.ID <= 0 {
+		v.add(path+".id", "must be a positive number")
+	}
+	// Номер бронирования - PNR посадочного талона, в BCBP под него 7 символов
+	if ticket.ID > bcbp.MaxTicketID {
+		v.add(path+".id", "must not exceed %d", bcbp.MaxTicketID)
+	}
+
+	v.match(path+".currency", ticket.Currency, currencyCode, "an ISO 4217 code like EUR")
+	v.fare(path, ticket)
+
+	if len(ticket.Itineraries) == 0 {
+		v.add(path+".itineraries", "at least one itinerary is required")
+	}
+
+	var dates tripDates
+	for i, itinerary := range ticket.Itineraries {
+		itineraryPath := fmt.Sprintf("%s.itineraries[%d]", path, i)
+		if len(itinerary.Segments) == 0 {
+			v.add(itineraryPath+".segments", "at least one segment is required")
+		}
+		if itinerary.Stops < 0 {
+			v.add(itineraryPath+".stops", "must not be negative")
+		}
+		for j, segment := range itinerary.Segments {
+			departure, arrival := v.segment(fmt.Sprintf("%s.segments[%d]", itineraryPath, j), segment)
+			if !departure.IsZero() && (dates.firstDeparture.IsZero() || departure.Before(dates.firstDeparture)) {
+				dates.firstDeparture = departure
+			}
+			if arrival.After(dates.lastArrival) {
+				dates.lastArrival = arrival
+			}
+		}
+		v.durations(itineraryPath, itinerary)
+	}
+
+	return dates
+}
+
+// amount проверяет сумму в валюте билета, пустая строка допустима только для необязательных сумм
+func (v *validator) amount(field, value, currency string, required bool) (money.Amount, bool) {
+	if value == "" {
+		if required {
+			v.add(field, "is required")
+		}
+		return money.Amount{}, false
+	}
+	amount, err := money.Parse(value, currency)
+	if err != nil {
+		v.add(field, "must be a non-negative amount like 471.38 in %s, got %q", currency, value)
+		return money.Amount{}, false
+	}
+	return amount, true
+}
+
+// fare проверяет цену, разбивку стоимости и статус оплаты. Разбивка должна сходиться с price до копейки
+func (v *validator) fare(path string, ticket models.Ticket) {
+	price, priceOK := v.amount(path+".price", ticket.Price, ticket.Currency, true)
+
+	if fare := ticket.Fare; fare != nil {
+		farePath := path + ".fare"
+		sum, sumOK := v.amount(farePath+".base_fare", fare.BaseFare, ticket.Currency, true)
+		items := func(field string, items []models.FareItem) {
+			for i, item := range items {
+				itemPath := fmt.Sprintf("%s.%s[%d]", farePath, field, i)
+				if item.Code == "" && item.Name == "" {
+					v.add(itemPath, "code or name is required")
+				}
+				amount, ok := v.amount(itemPath+".amount", item.Amount, ticket.Currency, true)
+				sum, sumOK = sum.Add(amount), sumOK && ok
+			}
+		}
+		items("taxes", fare.Taxes)
+		items("fees", fare.Fees)
+
+		total, totalOK := v.amount(farePath+".total", fare.Total, ticket.Currency, false)
+		if totalOK && priceOK && total != price {
+			v.add(farePath+".total", "is %s, but price is %s", total, price)
+		}
+		if sumOK && priceOK && sum != price {
+			v.add(farePath, "base fare, taxes and fees add up to %s, but price is %s", sum, price)
+		}
+	}
+
+	switch ticket.PaymentStatus {
+	case "", models.PaymentPaid, models.PaymentUnpaid:
+		if ticket.AmountPaid != "" {
+			v.add(path+".amount_paid", "is only allowed with payment_status %s", models.PaymentPartiallyPaid)
+		}
+	case models.PaymentPartiallyPaid:
+		paid, ok := v.amount(path+".amount_paid", ticket.AmountPaid, ticket.Currency, true)
+		if ok && priceOK && (paid.Minor == 0 || paid.Minor >= price.Minor) {
+			v.add(path+".amount_paid", "must be more than 0 and less than price %s, got %s", price, paid)
+		}
+	default:
+		v.add(path+".payment_status", "must be %s, %s or %s, got %q",
+			models.PaymentPaid, models.PaymentPartiallyPaid, models.PaymentUnpaid, ticket.PaymentStatus)
+	}
+}
+
+func (v *validator) segment(path string, segment models.Segments) (departure, arrival time.Time) {
+	v.match(path+".departure_airport", segment.DepartureAirport, airportCode, "a 3-letter IATA airport code")
+	v.match(path+".arrival_airport", segment.ArrivalAirport, airportCode, "a 3-letter IATA airport code")
+	if segment.DepartureAirport != "" && segment.DepartureAirport == segment.ArrivalAirport {
+		v.add(path+".arrival_airport", "must differ from departure_airport")
+	}
+
+	carrier, _ := segment.Flight()
+	v.match(path+".carrier", carrier, carrierCode, "a 2-3 character IATA airline code")
+
+	if segment.Distance < 0 {
+		v.add(path+".distance", "must not be negative")
+	}
+
+	departure, departureOK := v.time(path+".departure_time", segment.DepartureTime, segment.DepartureAirport)
+	arrival, arrivalOK := v.time(path+".arrival_time", segment.ArrivalTime, segment.ArrivalAirport)
+	if departureOK && arrivalOK && !arrival.After(departure) {
+		v.add(path+".arrival_time", "must be after departure_time")
+	}
+
+	return departure, arrival
+}
+
+// durations сверяет переданные длительности и пересадки с рассчитанными по временам сегментов.
+// Если часовой пояс какого-то аэропорта неизвестен, сравнивать не с чем - проверяется только формат
+func (v *validator) durations(path string, itin models.Itineraries) {
+	// Ошибки в самих временах уже добавлены при проверке сегментов
+	timing, err := itinerary.Compute(itin.Segments)
+	exact := err == nil && timing.Exact && len(itin.Segments) > 0
+
+	check := func(field, value string, computed time.Duration) {
+		if value == "" {
+			return
+		}
+		d, err := itinerary.ParseDuration(value)
+		if err != nil {
+			v.add(field, "must be a duration like 32:25, got %q", value)
+			return
+		}
+		if exact && !withinTolerance(d, computed) {
+			v.add(field, "is %s, but segment times give %s", value, itinerary.FormatDuration(computed))
+		}
+	}
+
+	check(path+".duration", itin.Duration, timing.Total)
+	for i, segment := range itin.Segments {
+		var computed time.Duration
+		if i < len(timing.Flights) {
+			computed = timing.Flights[i]
+		}
+		check(fmt.Sprintf("%s.segments[%d].duration", path, i), segment.Duration, computed)
+	}
+
+	if !exact {
+		return
+	}
+	for i, layover := range timing.Layovers {
+		if layover.Duration <= 0 {
+			v.add(fmt.Sprintf("%s.segments[%d].departure_time", path, i+1), "must be after arrival_time of the previous segment")
+		}
+	}
+}
+
+func withinTolerance(supplied, computed time.Duration) bool {
+	diff := supplied - computed
+	return diff > -durationTolerance && diff < durationTolerance
+}
+
+func (v *validator) time(field, value, airport string) (time.Time, bool) {
+	if !v.required(field, value) {
+		return time.Time{}, false
+	}
+	t, _, err := airports.ParseLocalTime(value, airport)
+	if err != nil {
+		v.add(field, "must be a timestamp like 2006-01-02T15:04:05 or RFC 3339, got %q", value)
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// seats проверяет, что места назначены пассажирам бронирования и не повторяются на сегменте
+func (v *validator) seats(path string, booking models.RequestData) {
+	// Тёзка-младенец не мешает назначить место взрослому или ребёнку: они идут в списке раньше
+	passengers := make(map[string]string)
+	for _, passenger := range booking.User.Passengers() {
+		key := passengerKey(passenger.FirstName, passenger.LastName)
+		if _, ok := passengers[key]; !ok {
+			passengers[key] = passenger.Type
+		}
+	}
+
+	for i, itinerary := range booking.Ticket.Itineraries {
+		for j, segment := range itinerary.Segments {
+			taken := make(map[string]bool, len(segment.Seats))
+			for k, seat := range segment.Seats {
+				seatPath := fmt.Sprintf("%s.ticket.itineraries[%d].segments[%d].seats[%d]", path, i, j, k)
+				v.match(seatPath+".seat", seat.Seat, seatNumber, "a seat like 12A")
+				if taken[seat.Seat] {
+					v.add(seatPath+".seat", "seat %s is assigned twice", seat.Seat)
+				}
+				taken[seat.Seat] = true
+				switch passengers[passengerKey(seat.FirstName, seat.LastName)] {
+				case "":
+					v.add(seatPath, "passenger %s %s is not in the booking", seat.FirstName, seat.LastName)
+				case models.PassengerInfant:
+					v.add(seatPath, "infant %s %s travels without a seat", seat.FirstName, seat.LastName)
+				}
+			}
+		}
+	}
+}
+
+func passengerKey(firstName, lastName string) string {
+	return strings.ToUpper(firstName) + "/" + strings.ToUpper(lastName)
+}
+
+func (v *validator) user(path string, user models.User, dates tripDates) {
+	if len(user.Adults) == 0 {
+		v.add(path+".adults", "at least one adult passenger is required")
+	}
+
+	for i, adult := range user.Adults {
+		v.person(fmt.Sprintf("%s.adults[%d]", path, i), adult, dates, false)
+	}
+
+	for i, child := range user.Children {
+		childPath := fmt.Sprintf("%s.children[%d]", path, i)
+		birth, ok := v.person(childPath, child, dates, true)
+		if ok && !dates.firstDeparture.IsZero() {
+			if age := yearsBetween(birth, dates.firstDeparture); age < 2 || age > 11 {
+				v.add(childPath+".birth_date", "child must be 2-11 years old on departure, got %d", age)
+			}
+		}
+	}
+
+	accompanying := make(map[int]bool, len(user.Infants))
+	for i, infant := range user.Infants {
+		infantPath := fmt.Sprintf("%s.infants[%d]", path, i)
+		birth, ok := v.person(infantPath, infant.Adult, dates, true)
+		if ok && !dates.lastArrival.IsZero() && yearsBetween(birth, dates.lastArrival) >= 2 {
+			v.add(infantPath+".birth_date", "infant must be under 2 years old for the whole trip, book a child instead")
+		}
+
+		switch {
+		case infant.AccompaniedBy < 0 || infant.AccompaniedBy >= len(user.Adults):
+			v.add(infantPath+".accompanied_by", "must be an index in adults, got %d", infant.AccompaniedBy)
+		case accompanying[infant.AccompaniedBy]:
+			v.add(infantPath+".accompanied_by", "adult %d already accompanies another infant", infant.AccompaniedBy)
+		default:
+			accompanying[infant.AccompaniedBy] = true
+		}
+	}
+}
+
+// person проверяет данные пассажира любого типа и возвращает дату рождения, если она передана и корректна.
+// birthRequired - для детей и младенцев, у которых по дате рождения проверяется возраст
+func (v *validator) person(path string, person models.Adult, dates tripDates, birthRequired bool) (birth time.Time, ok bool) {
+	v.required(path+".first_name", person.FirstName)
+	v.required(path+".last_name", person.LastName)
+
+	if birthRequired {
+		v.required(path+".birth_date", person.BirthDate)
+	}
+	if person.BirthDate != "" {
+		var err error
+		if birth, err = time.Parse(dateLayout, person.BirthDate); err != nil {
+			v.add(path+".birth_date", "must be a date like 2006-01-02, got %q", person.BirthDate)
+		} else if birth.After(time.Now()) {
+			v.add(path+".birth_date", "must not be in the future")
+		} else {
+			ok = true
+		}
+	}
+
+	if person.Gender != "" && person.Gender != "M" && person.Gender != "F" {
+		v.add(path+".gender", "must be M or F, got %q", person.Gender)
+	}
+
+	if person.SeriaPassport < 0 {
+		v.add(path+".seria_passport", "must not be negative")
+	}
+	if person.NumberPassport <= 0 {
+		v.add(path+".number_passport", "must be a positive number")
+	}
+
+	if person.ValidityPeriod != "" {
+		if validity, err := time.Parse(dateLayout, person.ValidityPeriod); err != nil {
+			v.add(path+".validity_period", "must be a date like 2006-01-02, got %q", person.ValidityPeriod)
+		} else if !dates.lastArrival.IsZero() && validity.Before(dates.lastArrival) {
+			v.add(path+".validity_period", "passport expires before the end of the trip")
+		}
+	}
+
+	return birth, ok
+}
+
+// yearsBetween возвращает полных лет от рождения до даты
+func yearsBetween(birth, at time.Time) int {
+	years := at.Year() - birth.Year()
+	if at.Month() < birth.Month() || (at.Month() == birth.Month() && at.Day() < birth.Day()) {
+		years--
+	}
+	return years
+}